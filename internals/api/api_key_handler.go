@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *log.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+func (ah *APIKeyHandler) HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := ah.apiKeyStore.ListAPIKeys(middleware.GetUser(r).ID)
+	if err != nil {
+		ah.logger.Printf("Error:: Listing API keys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list API keys",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"api_keys": keys,
+	})
+}
+
+// HandleCreateAPIKey creates a key for the caller. The response is the only
+// time the key itself is shown.
+func (ah *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string     `json:"name"`
+		Scopes []string   `json:"scopes"`
+		Expiry *time.Time `json:"expiry"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	key := &store.APIKey{
+		UserID: middleware.GetUser(r).ID,
+		Name:   req.Name,
+		Scopes: req.Scopes,
+		Expiry: req.Expiry,
+	}
+	err = key.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	created, err := ah.apiKeyStore.CreateAPIKey(key)
+	if errors.Is(err, store.ErrDuplicateAPIKeyName) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ah.logger.Printf("Error:: Creating API key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to create API key",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"api_key": created,
+	})
+}
+
+func (ah *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid API key ID",
+		})
+		return
+	}
+	found, err := ah.apiKeyStore.DeleteAPIKey(middleware.GetUser(r).ID, keyID)
+	if err != nil {
+		ah.logger.Printf("Error:: Deleting API key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to delete API key",
+		})
+		return
+	}
+	if !found {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "API key not found",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
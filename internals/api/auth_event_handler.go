@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// recordAuthEvent adds event to the security audit log with the client of r.
+// A failure is logged but does not fail the request.
+func recordAuthEvent(s store.AuthEventStore, logger *log.Logger, r *http.Request, event store.AuthEvent) {
+	event.IP = utils.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+	err := s.RecordAuthEvent(&event)
+	if err != nil {
+		logger.Printf("Error:: Recording %s auth event: %v", event.Type, err)
+	}
+}
+
+type AuthEventHandler struct {
+	authEventStore store.AuthEventStore
+	logger         *log.Logger
+}
+
+func NewAuthEventHandler(authEventStore store.AuthEventStore, logger *log.Logger) *AuthEventHandler {
+	return &AuthEventHandler{
+		authEventStore: authEventStore,
+		logger:         logger,
+	}
+}
+
+// HandleGetMyEvents lists the security events of the authenticated user, so
+// they can spot logins they did not make.
+func (h *AuthEventHandler) HandleGetMyEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := readAuthEventFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	userID := middleware.GetUser(r).ID
+	filter.UserID = &userID
+	filter.Email = ""
+	h.listEvents(w, filter)
+}
+
+// HandleGetEvents queries the security events of all users for
+// administrators.
+func (h *AuthEventHandler) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := readAuthEventFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	h.listEvents(w, filter)
+}
+
+func (h *AuthEventHandler) listEvents(w http.ResponseWriter, filter store.AuthEventFilter) {
+	events, err := h.authEventStore.ListAuthEvents(filter)
+	if err != nil {
+		h.logger.Printf("Error:: Listing auth events: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get security events",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"events": events,
+	})
+}
+
+func readAuthEventFilter(qs url.Values) (store.AuthEventFilter, error) {
+	filter := store.AuthEventFilter{
+		Email: qs.Get("email"),
+		Type:  qs.Get("type"),
+		IP:    qs.Get("ip"),
+		Limit: 50,
+	}
+	var err error
+	filter.UserID, err = utils.ReadIntQuery(qs, "user_id")
+	if err != nil {
+		return filter, err
+	}
+	filter.Since, err = readTimeQuery(qs, "since")
+	if err != nil {
+		return filter, err
+	}
+	filter.Until, err = readTimeQuery(qs, "until")
+	if err != nil {
+		return filter, err
+	}
+	limit, err := utils.ReadIntQuery(qs, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit != nil {
+		if *limit < 1 || *limit > 100 {
+			return filter, errors.New("limit must be between 1 and 100")
+		}
+		filter.Limit = *limit
+	}
+	offset, err := utils.ReadIntQuery(qs, "offset")
+	if err != nil {
+		return filter, err
+	}
+	if offset != nil {
+		if *offset < 0 {
+			return filter, errors.New("offset must not be negative")
+		}
+		filter.Offset = *offset
+	}
+	return filter, nil
+}
+
+// readTimeQuery parses an RFC 3339 query parameter, nil when absent.
+func readTimeQuery(qs url.Values, key string) (*time.Time, error) {
+	value := qs.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter: must be an RFC 3339 time", key)
+	}
+	return &t, nil
+}
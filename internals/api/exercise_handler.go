@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+)
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *log.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+func (eh *ExerciseHandler) HandleSearchExercises(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	limit, err := utils.ReadIntQuery(qs, "limit")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter := store.ExerciseFilter{
+		UserID:          middleware.GetUser(r).ID,
+		Search:          qs.Get("q"),
+		Muscle:          qs.Get("muscle"),
+		Equipment:       qs.Get("equipment"),
+		MovementPattern: qs.Get("movement_pattern"),
+	}
+	if limit != nil {
+		filter.Limit = *limit
+	}
+
+	exercises, err := eh.exerciseStore.SearchExercises(filter)
+	if err != nil {
+		eh.logger.Printf("Error:: Searching exercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to search exercises",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"exercises": exercises,
+	})
+}
+
+func (eh *ExerciseHandler) HandleGetExerciseByID(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadIDParam(r)
+	if err != nil {
+		eh.logger.Printf("Error:: Reading exercise ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid exercise ID",
+		})
+		return
+	}
+	exercise, err := eh.exerciseStore.GetExerciseByID(exerciseID, middleware.GetUser(r).ID)
+	if err != nil {
+		eh.logger.Printf("Error:: Getting exercise by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get exercise",
+		})
+		return
+	}
+	if exercise == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "Exercise not found",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"exercise": exercise,
+	})
+}
+
+type createExerciseRequest struct {
+	Name             string   `json:"name"`
+	Aliases          []string `json:"aliases"`
+	PrimaryMuscles   []string `json:"primary_muscles"`
+	SecondaryMuscles []string `json:"secondary_muscles"`
+	Equipment        string   `json:"equipment"`
+	MovementPattern  string   `json:"movement_pattern"`
+}
+
+// HandleCreateExercise adds a custom exercise that only the current user sees.
+func (eh *ExerciseHandler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
+	var req createExerciseRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		eh.logger.Printf("Error:: Decoding create exercise request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+	exercise, err := eh.exerciseStore.CreateExercise(&store.Exercise{
+		Name:             req.Name,
+		Aliases:          req.Aliases,
+		PrimaryMuscles:   req.PrimaryMuscles,
+		SecondaryMuscles: req.SecondaryMuscles,
+		Equipment:        req.Equipment,
+		MovementPattern:  req.MovementPattern,
+		UserID:           &userID,
+	})
+	if errors.Is(err, store.ErrInvalidExercise) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, store.ErrExerciseExists) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		eh.logger.Printf("Error:: Creating exercise: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to create exercise",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"exercise": exercise,
+	})
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/policy"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type GoalHandler struct {
+	goalStore    store.GoalStore
+	profileStore store.ProfileStore
+	logger       *log.Logger
+}
+
+func NewGoalHandler(goalStore store.GoalStore, profileStore store.ProfileStore, logger *log.Logger) *GoalHandler {
+	return &GoalHandler{
+		goalStore:    goalStore,
+		profileStore: profileStore,
+		logger:       logger,
+	}
+}
+
+func (gh *GoalHandler) HandleGetGoals(w http.ResponseWriter, r *http.Request) {
+	goals, err := gh.goalStore.ListGoals(middleware.GetUser(r).ID)
+	if err != nil {
+		gh.logger.Printf("Error:: Listing goals: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list goals",
+		})
+		return
+	}
+	weekStart := profileOf(gh.profileStore, gh.logger, r).WeekStart
+	for i := range goals {
+		if err := gh.evaluate(&goals[i], weekStart); err != nil {
+			gh.logger.Printf("Error:: Evaluating goal %d: %v", goals[i].ID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+				"error": "Failed to list goals",
+			})
+			return
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"goals": goals,
+	})
+}
+
+func (gh *GoalHandler) HandleGetGoalByID(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.readGoal(w, r, policy.Read)
+	if !ok {
+		return
+	}
+	gh.writeGoal(w, r, http.StatusOK, goal)
+}
+
+type goalRequest struct {
+	Title      *string              `json:"title"`
+	Metric     *string              `json:"metric"`
+	Target     *float64             `json:"target"`
+	Period     *string              `json:"period"`
+	ExerciseID nullable[int]        `json:"exercise_id"`
+	StartDate  *store.Date          `json:"start_date"`
+	Deadline   nullable[store.Date] `json:"deadline"`
+	Timezone   *string              `json:"timezone"`
+}
+
+// apply copies the fields present in the request onto the goal. exercise_id
+// and deadline are cleared with null.
+func (req *goalRequest) apply(goal *store.Goal) {
+	if req.Title != nil {
+		goal.Title = *req.Title
+	}
+	if req.Metric != nil {
+		goal.Metric = *req.Metric
+	}
+	if req.Target != nil {
+		goal.Target = *req.Target
+	}
+	if req.Period != nil {
+		goal.Period = *req.Period
+	}
+	if req.ExerciseID.Set {
+		goal.ExerciseID = req.ExerciseID.Value
+	}
+	if req.StartDate != nil {
+		goal.StartDate = *req.StartDate
+	}
+	if req.Deadline.Set {
+		goal.Deadline = store.Date{}
+		if req.Deadline.Value != nil {
+			goal.Deadline = *req.Deadline.Value
+		}
+	}
+	if req.Timezone != nil {
+		goal.Timezone = *req.Timezone
+	}
+}
+
+// HandleCreateGoal creates a goal. start_date defaults to today in the goal's
+// timezone.
+func (gh *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var req goalRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		gh.logger.Printf("Error:: Decoding create goal request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	goal := &store.Goal{UserID: middleware.GetUser(r).ID, Timezone: profileOf(gh.profileStore, gh.logger, r).Timezone}
+	req.apply(goal)
+	if goal.StartDate.IsZero() {
+		if loc, err := store.LoadTimezone(goal.Timezone); err == nil {
+			goal.StartDate = store.DateIn(time.Now(), loc)
+		}
+	}
+
+	created, err := gh.goalStore.CreateGoal(goal)
+	if errors.Is(err, store.ErrInvalidGoal) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		gh.logger.Printf("Error:: Creating goal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to create goal",
+		})
+		return
+	}
+	gh.writeGoal(w, r, http.StatusCreated, created)
+}
+
+func (gh *GoalHandler) HandleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.readGoal(w, r, policy.Update)
+	if !ok {
+		return
+	}
+	var req goalRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		gh.logger.Printf("Error:: Decoding update goal request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	req.apply(goal)
+
+	err = gh.goalStore.UpdateGoal(goal)
+	if errors.Is(err, store.ErrInvalidGoal) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		gh.logger.Printf("Error:: Updating goal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to update goal",
+		})
+		return
+	}
+	gh.writeGoal(w, r, http.StatusOK, goal)
+}
+
+func (gh *GoalHandler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.readGoal(w, r, policy.Delete)
+	if !ok {
+		return
+	}
+	err := gh.goalStore.DeleteGoal(goal.ID)
+	if err != nil {
+		gh.logger.Printf("Error:: Deleting goal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to delete goal",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetStreak returns the current and longest workout streaks. ?tz= sets
+// the day that counts as today (default the profile's timezone) and
+// ?rest_days= how many days in a row may be skipped without breaking a streak
+// (default 0).
+func (gh *GoalHandler) HandleGetStreak(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	tz := qs.Get("tz")
+	if tz == "" {
+		tz = profileOf(gh.profileStore, gh.logger, r).Timezone
+	}
+	loc, err := store.LoadTimezone(tz)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	restDays, err := utils.ReadIntQuery(qs, "rest_days")
+	if err != nil || restDays != nil && (*restDays < 0 || *restDays > 6) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "invalid rest_days parameter: must be between 0 and 6",
+		})
+		return
+	}
+	if restDays == nil {
+		restDays = new(int)
+	}
+
+	days, err := gh.goalStore.GetWorkoutDays(middleware.GetUser(r).ID)
+	if err != nil {
+		gh.logger.Printf("Error:: Getting workout days: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get streak",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"streak": store.ComputeStreak(days, store.DateIn(time.Now(), loc), *restDays),
+	})
+}
+
+// evaluate fills in the progress of the goal as of today in its timezone.
+// Weekly goals start over on weekStart.
+func (gh *GoalHandler) evaluate(goal *store.Goal, weekStart string) error {
+	loc, err := store.LoadTimezone(goal.Timezone)
+	if err != nil {
+		return err
+	}
+	today := store.DateIn(time.Now(), loc)
+	from, to := goal.Window(today, weekStart)
+	contributions, err := gh.goalStore.GetGoalContributions(goal, from, to)
+	if err != nil {
+		return err
+	}
+	progress := goal.Evaluate(contributions, today, weekStart)
+	goal.Progress = &progress
+	return nil
+}
+
+func (gh *GoalHandler) writeGoal(w http.ResponseWriter, r *http.Request, status int, goal *store.Goal) {
+	if err := gh.evaluate(goal, profileOf(gh.profileStore, gh.logger, r).WeekStart); err != nil {
+		gh.logger.Printf("Error:: Evaluating goal %d: %v", goal.ID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to evaluate goal",
+		})
+		return
+	}
+	utils.WriteJSON(w, status, utils.Envelope{
+		"goal": goal,
+	})
+}
+
+// readGoal loads the goal from the {id} URL parameter and writes the error
+// response when it is missing or the caller may not perform action on it.
+func (gh *GoalHandler) readGoal(w http.ResponseWriter, r *http.Request, action policy.Action) (*store.Goal, bool) {
+	goalID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("Error:: Reading goal ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid goal ID",
+		})
+		return nil, false
+	}
+	goal, err := gh.goalStore.GetGoalByID(goalID)
+	if err != nil {
+		gh.logger.Printf("Error:: Getting goal by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get goal",
+		})
+		return nil, false
+	}
+	if goal == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "Goal not found",
+		})
+		return nil, false
+	}
+	if !policy.Can(middleware.GetUser(r), action, goal) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to access this goal",
+		})
+		return nil, false
+	}
+	return goal, true
+}
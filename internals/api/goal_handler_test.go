@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"go_beginner/internals/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoalRequestApply(t *testing.T) {
+	benchID := 7
+	goal := &store.Goal{Title: "Bench 100", ExerciseID: &benchID, Deadline: store.NewDate(2025, 6, 30)}
+
+	var req goalRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"title": "Bench 110"}`), &req))
+	req.apply(goal)
+	assert.Equal(t, "Bench 110", goal.Title)
+	assert.Equal(t, &benchID, goal.ExerciseID, "left out")
+	assert.Equal(t, "2025-06-30", goal.Deadline.String(), "left out")
+
+	req = goalRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"exercise_id": null, "deadline": null}`), &req))
+	req.apply(goal)
+	assert.Nil(t, goal.ExerciseID)
+	assert.True(t, goal.Deadline.IsZero())
+
+	req = goalRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"exercise_id": 9, "deadline": "2025-09-30"}`), &req))
+	req.apply(goal)
+	require.NotNil(t, goal.ExerciseID)
+	assert.Equal(t, 9, *goal.ExerciseID)
+	assert.Equal(t, "2025-09-30", goal.Deadline.String())
+}
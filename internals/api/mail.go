@@ -0,0 +1,16 @@
+package api
+
+import (
+	"go_beginner/internals/mailer"
+	"log"
+)
+
+// sendMail sends msg in the background so that the response does not wait
+// for the mail server, and does not take longer for existing accounts.
+func sendMail(m mailer.Mailer, logger *log.Logger, msg mailer.Message) {
+	go func() {
+		if err := m.Send(msg); err != nil {
+			logger.Printf("Error:: Sending %q email: %v", msg.Subject, err)
+		}
+	}()
+}
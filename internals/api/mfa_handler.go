@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/internals/totp"
+	"go_beginner/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// mfaIssuer is the name authenticator apps show next to the account.
+const mfaIssuer = "Workout App"
+
+type MFAHandler struct {
+	mfaStore          store.MFAStore
+	userStore         store.UserStore
+	loginAttemptStore store.LoginAttemptStore
+	authEventStore    store.AuthEventStore
+	logger            *log.Logger
+}
+
+func NewMFAHandler(mfaStore store.MFAStore, userStore store.UserStore, loginAttemptStore store.LoginAttemptStore, authEventStore store.AuthEventStore, logger *log.Logger) *MFAHandler {
+	return &MFAHandler{
+		mfaStore:          mfaStore,
+		userStore:         userStore,
+		loginAttemptStore: loginAttemptStore,
+		authEventStore:    authEventStore,
+		logger:            logger,
+	}
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (mh *MFAHandler) HandleGetMFA(w http.ResponseWriter, r *http.Request) {
+	mfa, err := mh.mfaStore.GetMFA(middleware.GetUser(r).ID)
+	if err != nil {
+		mh.logger.Printf("Error:: Getting two-factor setup: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get two-factor authentication",
+		})
+		return
+	}
+	if mfa == nil {
+		mfa = &store.UserMFA{}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"mfa": mfa,
+	})
+}
+
+// HandleBeginMFA starts enrollment with a new secret. Nothing changes for
+// logins until the setup is confirmed with a code from the app.
+func (mh *MFAHandler) HandleBeginMFA(w http.ResponseWriter, r *http.Request) {
+	user, err := mh.userStore.GetUserByID(middleware.GetUser(r).ID)
+	if err != nil || user == nil {
+		mh.logger.Printf("Error:: Getting user by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to set up two-factor authentication",
+		})
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		mh.logger.Printf("Error:: Generating TOTP secret: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to set up two-factor authentication",
+		})
+		return
+	}
+	err = mh.mfaStore.BeginMFA(user.ID, secret)
+	if errors.Is(err, store.ErrMFAAlreadyEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("Error:: Beginning two-factor setup: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to set up two-factor authentication",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"secret":           totp.EncodeSecret(secret),
+		"provisioning_uri": totp.ProvisioningURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// HandleConfirmMFA enables two-factor authentication with a first code and
+// returns the recovery codes. They are only shown this once.
+func (mh *MFAHandler) HandleConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	codes, err := store.GenerateRecoveryCodes()
+	if err != nil {
+		mh.logger.Printf("Error:: Generating recovery codes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to enable two-factor authentication",
+		})
+		return
+	}
+	ok, err := mh.mfaStore.ConfirmMFA(middleware.GetUser(r).ID, req.Code, codes)
+	if errors.Is(err, store.ErrMFAAlreadyEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("Error:: Confirming two-factor setup: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to enable two-factor authentication",
+		})
+		return
+	}
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid code",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"recovery_codes": codes,
+	})
+}
+
+// HandleDisableMFA turns two-factor authentication off. It takes a current
+// code, so that a stolen session alone cannot remove the second factor. Wrong
+// codes count as failed logins of the account, so they cannot be guessed.
+func (mh *MFAHandler) HandleDisableMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	user, err := mh.userStore.GetUserByID(middleware.GetUser(r).ID)
+	if err != nil || user == nil {
+		mh.logger.Printf("Error:: Getting user by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+	accountKey := store.AccountLoginKey(user.Email)
+	wait, err := mh.loginAttemptStore.RetryAfter(accountKey)
+	if err != nil {
+		mh.logger.Printf("Error:: Checking login attempts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{
+			"error": "Too many failed attempts, try again later",
+		})
+		return
+	}
+
+	ok, err := mh.mfaStore.VerifyCode(user.ID, req.Code)
+	if err != nil {
+		mh.logger.Printf("Error:: Verifying two-factor code: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+	if !ok {
+		recordAuthEvent(mh.authEventStore, mh.logger, r, store.AuthEvent{
+			UserID: &user.ID,
+			Email:  user.Email,
+			Type:   store.AuthEventLoginFailed,
+			Detail: "wrong two-factor code when disabling it",
+		})
+		_, err = mh.loginAttemptStore.RecordFailure(accountKey, store.AccountLoginThrottle)
+		if err != nil {
+			mh.logger.Printf("Error:: Recording failed login: %v", err)
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid code",
+		})
+		return
+	}
+	err = mh.mfaStore.DisableMFA(user.ID)
+	if err != nil {
+		mh.logger.Printf("Error:: Disabling two-factor authentication: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"go_beginner/internals/oidc"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+// oidcStateCookie ties a login to the browser that started it. Without it,
+// anyone could send a victim the callback URL of a login they started, and
+// log the victim into the attacker's account.
+const oidcStateCookie = "oidc_state"
+
+// errUnconfirmedAccount is returned for a provider login whose email address
+// belongs to an account that has not been activated. Whoever registered it
+// may not own the address, and linking would share the account with them.
+var errUnconfirmedAccount = errors.New("the account with this email address is not activated")
+
+// OIDCHandler logs users in with an external OpenID Connect provider. Once
+// the provider has vouched for the user, the session starts like after a
+// password login, second factor included.
+type OIDCHandler struct {
+	provider  *oidc.Provider
+	oidcStore store.OIDCStore
+	userStore store.UserStore
+	logins    *TokenHandler
+	logger    *log.Logger
+}
+
+func NewOIDCHandler(provider *oidc.Provider, oidcStore store.OIDCStore, userStore store.UserStore, logins *TokenHandler, logger *log.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		provider:  provider,
+		oidcStore: oidcStore,
+		userStore: userStore,
+		logins:    logins,
+		logger:    logger,
+	}
+}
+
+// HandleBeginLogin redirects to the provider's login page.
+func (h *OIDCHandler) HandleBeginLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := oidc.NewAuthRequest()
+	if err == nil {
+		err = h.oidcStore.SaveAuthRequest(req, store.OIDCAuthRequestTTL)
+	}
+	if err != nil {
+		h.logger.Printf("Error:: Starting OIDC login: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to log in",
+		})
+		return
+	}
+	authURL, err := h.provider.AuthCodeURL(r.Context(), req)
+	if err != nil {
+		h.logger.Printf("Error:: Starting OIDC login: %v", err)
+		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{
+			"error": "The identity provider is unavailable",
+		})
+		return
+	}
+	http.SetCookie(w, newOIDCStateCookie(stateCookieValue(req.State), int(store.OIDCAuthRequestTTL/time.Second)))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleCallback is where the provider sends the user back to. It exchanges
+// the code for an ID token and logs in the user it belongs to. A provider
+// account that is not linked yet is linked to the user with the same email
+// address, if the provider has verified that address.
+func (h *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
+			"error": "The identity provider did not log you in: " + providerErr,
+		})
+		return
+	}
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "code and state are required",
+		})
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateCookieValue(state))) != 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "This login was not started in this browser, please start again",
+		})
+		return
+	}
+	http.SetCookie(w, newOIDCStateCookie("", -1))
+
+	req, err := h.oidcStore.ConsumeAuthRequest(state)
+	if err != nil {
+		h.logger.Printf("Error:: Getting OIDC login: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to log in",
+		})
+		return
+	}
+	if req == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid or expired login, please start again",
+		})
+		return
+	}
+
+	claims, err := h.provider.Exchange(r.Context(), code, req)
+	if errors.Is(err, oidc.ErrInvalidIDToken) {
+		h.logger.Printf("Warning:: Rejected OIDC ID token from %s: %v", utils.ClientIP(r), err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
+			"error": "Login with the identity provider failed",
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error:: Exchanging OIDC code: %v", err)
+		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{
+			"error": "Login with the identity provider failed",
+		})
+		return
+	}
+
+	user, err := h.userForClaims(claims)
+	if errors.Is(err, errUnconfirmedAccount) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Confirm your email address with the link we sent you before logging in with the identity provider",
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error:: Finding OIDC user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to log in",
+		})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "No account matches the verified email address of this login, sign up first",
+		})
+		return
+	}
+	h.logins.startSession(w, r, user, store.AccountLoginKey(user.Email), "oidc")
+}
+
+func stateCookieValue(state string) string {
+	hash := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(hash[:])
+}
+
+// newOIDCStateCookie returns the state cookie; a negative maxAge deletes it.
+func newOIDCStateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/login/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// userForClaims returns the user linked to the provider account, linking it
+// by verified email address when needed. It returns nil when there is no
+// such user, and errUnconfirmedAccount when the user is not activated.
+func (h *OIDCHandler) userForClaims(claims *oidc.Claims) (*store.User, error) {
+	issuer := h.provider.Issuer()
+	userID, err := h.oidcStore.GetUserIDForIdentity(issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if userID != 0 {
+		return h.userStore.GetUserByID(userID)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, nil
+	}
+	user, err := h.userStore.GetUserByEmail(claims.Email)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if !user.Activated {
+		return nil, errUnconfirmedAccount
+	}
+	err = h.oidcStore.LinkIdentity(user.ID, issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
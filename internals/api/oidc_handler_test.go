@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"go_beginner/internals/oidc"
+	"go_beginner/internals/store"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOIDCStore keeps no requests; it only records which states were redeemed
+// and which users were linked.
+type fakeOIDCStore struct {
+	consumed []string
+	linked   []int
+}
+
+func (s *fakeOIDCStore) SaveAuthRequest(req *oidc.AuthRequest, ttl time.Duration) error { return nil }
+
+func (s *fakeOIDCStore) ConsumeAuthRequest(state string) (*oidc.AuthRequest, error) {
+	s.consumed = append(s.consumed, state)
+	return nil, nil
+}
+
+func (s *fakeOIDCStore) GetUserIDForIdentity(issuer, subject string) (int, error) { return 0, nil }
+
+func (s *fakeOIDCStore) LinkIdentity(userID int, issuer, subject string) error {
+	s.linked = append(s.linked, userID)
+	return nil
+}
+
+// fakeUserStore finds users by email. Other methods are not implemented.
+type fakeUserStore struct {
+	store.UserStore
+	users map[string]*store.User
+}
+
+func (s *fakeUserStore) GetUserByEmail(email string) (*store.User, error) {
+	return s.users[email], nil
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	var idp *httptest.Server
+	idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	}))
+	defer idp.Close()
+
+	oidcStore := &fakeOIDCStore{}
+	provider := oidc.New(oidc.Config{Issuer: idp.URL, ClientID: "workouts", RedirectURL: "http://app.test/login/oidc/callback"})
+	handler := NewOIDCHandler(provider, oidcStore, nil, nil, log.New(io.Discard, "", 0))
+
+	beginLogin := func() (string, *http.Cookie) {
+		rec := httptest.NewRecorder()
+		handler.HandleBeginLogin(rec, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+		require.Equal(t, http.StatusFound, rec.Code)
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+		return location.Query().Get("state"), cookies[0]
+	}
+	callback := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?code=abc&state="+url.QueryEscape(state), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.HandleCallback(rec, req)
+		return rec
+	}
+
+	state, cookie := beginLogin()
+	_, otherCookie := beginLogin()
+
+	rec := callback(state, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "no cookie")
+	rec = callback(state, otherCookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "cookie of another login")
+	assert.Empty(t, oidcStore.consumed, "the state is not redeemed for another browser")
+
+	rec = callback(state, cookie)
+	assert.Equal(t, []string{state}, oidcStore.consumed)
+	cleared := rec.Result().Cookies()
+	require.Len(t, cleared, 1)
+	assert.Equal(t, oidcStateCookie, cleared[0].Name)
+	assert.Negative(t, cleared[0].MaxAge)
+}
+
+func TestOIDCLinksOnlyActivatedAccounts(t *testing.T) {
+	oidcStore := &fakeOIDCStore{}
+	userStore := &fakeUserStore{users: map[string]*store.User{
+		"ada@example.com":   {ID: 1, Email: "ada@example.com", Activated: true},
+		"grace@example.com": {ID: 2, Email: "grace@example.com"},
+	}}
+	provider := oidc.New(oidc.Config{Issuer: "https://idp.test", ClientID: "workouts"})
+	handler := NewOIDCHandler(provider, oidcStore, userStore, nil, log.New(io.Discard, "", 0))
+
+	user, err := handler.userForClaims(&oidc.Claims{Subject: "a", Email: "ada@example.com", EmailVerified: true})
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, 1, user.ID)
+
+	// Someone registered this address without confirming it; the provider
+	// login of the address's owner must not be linked to, or activate, that
+	// account.
+	_, err = handler.userForClaims(&oidc.Claims{Subject: "g", Email: "grace@example.com", EmailVerified: true})
+	assert.ErrorIs(t, err, errUnconfirmedAccount)
+
+	user, err = handler.userForClaims(&oidc.Claims{Subject: "u", Email: "ada@example.com"})
+	require.NoError(t, err)
+	assert.Nil(t, user, "the provider has not verified the address")
+
+	assert.Equal(t, []int{1}, oidcStore.linked)
+}
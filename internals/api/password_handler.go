@@ -0,0 +1,300 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_beginner/internals/mailer"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/passwords"
+	"go_beginner/internals/store"
+	"go_beginner/internals/tokens"
+	"go_beginner/utils"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type PasswordHandler struct {
+	userStore         store.UserStore
+	tokenStore        store.TokenStore
+	loginAttemptStore store.LoginAttemptStore
+	breached          *passwords.BreachedList
+	authEventStore    store.AuthEventStore
+	mailer            mailer.Mailer
+	clientURL         string // base of the links in emails
+	logger            *log.Logger
+}
+
+func NewPasswordHandler(userStore store.UserStore, tokenStore store.TokenStore, loginAttemptStore store.LoginAttemptStore, breached *passwords.BreachedList, authEventStore store.AuthEventStore, mailer mailer.Mailer, clientURL string, logger *log.Logger) *PasswordHandler {
+	return &PasswordHandler{
+		userStore:         userStore,
+		tokenStore:        tokenStore,
+		loginAttemptStore: loginAttemptStore,
+		breached:          breached,
+		authEventStore:    authEventStore,
+		mailer:            mailer,
+		clientURL:         clientURL,
+		logger:            logger,
+	}
+}
+
+// passwordResetPagePath is the page of the client that the reset email links
+// to. It asks for the new password and sends it with the token of the link to
+// PUT /password-reset.
+const passwordResetPagePath = "/reset-password"
+
+// HandleRequestPasswordReset emails a reset link to the account with the
+// given email. The response is the same whether the account exists or not,
+// so it cannot be used to find out who has an account.
+func (ph *PasswordHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Email == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	accepted := utils.Envelope{
+		"message": "If an account exists for that email, a password reset link has been sent",
+	}
+
+	user, err := ph.userStore.GetUserByEmail(req.Email)
+	if err != nil {
+		ph.logger.Printf("Error:: Getting user by email: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to request password reset",
+		})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	// Only the latest reset link works.
+	err = ph.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		ph.logger.Printf("Error:: Deleting old password reset tokens: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to request password reset",
+		})
+		return
+	}
+	token, err := ph.tokenStore.CrateNewToken(user.ID, tokens.PasswordResetTokenTTL, tokens.ScopePasswordReset)
+	if err != nil {
+		ph.logger.Printf("Error:: Creating password reset token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to request password reset",
+		})
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password:\n\n%s%s?token=%s\n\n"+
+			"The link expires in %d minutes and can only be used once. If you did not ask for a password reset, "+
+			"you can ignore this email.\n", user.Name, ph.clientURL, passwordResetPagePath, url.QueryEscape(token.PlainText),
+			int(tokens.PasswordResetTokenTTL.Minutes())),
+	}
+	sendMail(ph.mailer, ph.logger, msg)
+	utils.WriteJSON(w, http.StatusAccepted, accepted)
+}
+
+// HandleResetPassword sets a new password with a reset token and logs the
+// user out everywhere.
+func (ph *PasswordHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	if err := validatePassword(req.Password, ph.breached); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	userID, err := ph.tokenStore.ConsumeToken(tokens.ScopePasswordReset, req.Token)
+	if err != nil {
+		ph.logger.Printf("Error:: Consuming password reset token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to reset password",
+		})
+		return
+	}
+	if userID == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid or expired password reset token",
+		})
+		return
+	}
+
+	err = ph.setPassword(userID, req.Password)
+	if err != nil {
+		ph.logger.Printf("Error:: Resetting password: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to reset password",
+		})
+		return
+	}
+	recordAuthEvent(ph.authEventStore, ph.logger, r, store.AuthEvent{
+		UserID: &userID,
+		Type:   store.AuthEventPasswordReset,
+	})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"message": "Your password has been reset, please log in again",
+	})
+}
+
+// HandleChangePassword sets a new password for the authenticated user, who
+// has to know the current one. Every other session is logged out; wrong
+// current passwords count as failed logins of the account.
+func (ph *PasswordHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.CurrentPassword == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "current_password and new_password are required",
+		})
+		return
+	}
+	if err := validatePassword(req.NewPassword, ph.breached); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := ph.userStore.GetUserByID(middleware.GetUser(r).ID)
+	if err != nil || user == nil {
+		ph.logger.Printf("Error:: Getting user by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to change password",
+		})
+		return
+	}
+	accountKey := store.AccountLoginKey(user.Email)
+	wait, err := ph.loginAttemptStore.RetryAfter(accountKey)
+	if err != nil {
+		ph.logger.Printf("Error:: Checking login attempts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to change password",
+		})
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{
+			"error": "Too many failed attempts, try again later",
+		})
+		return
+	}
+	match, err := user.PasswordHash.Check(req.CurrentPassword)
+	if err != nil {
+		ph.logger.Printf("Error:: Checking password: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to change password",
+		})
+		return
+	}
+	if !match {
+		recordAuthEvent(ph.authEventStore, ph.logger, r, store.AuthEvent{
+			UserID: &user.ID,
+			Email:  user.Email,
+			Type:   store.AuthEventLoginFailed,
+			Detail: "wrong current password when changing it",
+		})
+		_, err = ph.loginAttemptStore.RecordFailure(accountKey, store.AccountLoginThrottle)
+		if err != nil {
+			ph.logger.Printf("Error:: Recording failed login: %v", err)
+		}
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Current password is incorrect",
+		})
+		return
+	}
+
+	err = user.PasswordHash.Set(req.NewPassword)
+	if err == nil {
+		err = ph.userStore.UpdatePassword(user)
+	}
+	if err == nil {
+		err = ph.revokeOtherSessions(user.ID, middleware.GetToken(r))
+	}
+	if err != nil {
+		ph.logger.Printf("Error:: Changing password: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to change password",
+		})
+		return
+	}
+	recordAuthEvent(ph.authEventStore, ph.logger, r, store.AuthEvent{
+		UserID: &user.ID,
+		Email:  user.Email,
+		Type:   store.AuthEventPasswordChanged,
+	})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"message": "Your password has been changed and your other sessions have been logged out",
+	})
+}
+
+// revokeOtherSessions logs the user out of every session but the one of
+// currentToken, and invalidates password reset links.
+func (ph *PasswordHandler) revokeOtherSessions(userID int, currentToken string) error {
+	sessions, err := ph.tokenStore.ListSessions(userID, currentToken)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.Current {
+			continue
+		}
+		_, err = ph.tokenStore.DeleteSession(userID, session.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return ph.tokenStore.DeleteAllTokensForUser(userID, tokens.ScopePasswordReset)
+}
+
+// setPassword stores the new password and revokes every token of the user.
+func (ph *PasswordHandler) setPassword(userID int, password string) error {
+	user, err := ph.userStore.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %d not found", userID)
+	}
+	err = user.PasswordHash.Set(password)
+	if err != nil {
+		return err
+	}
+	err = ph.userStore.UpdatePassword(user)
+	if err != nil {
+		return err
+	}
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh, tokens.ScopePasswordReset} {
+		err = ph.tokenStore.DeleteAllTokensForUser(userID, scope)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+)
+
+type ProfileHandler struct {
+	profileStore store.ProfileStore
+	logger       *log.Logger
+}
+
+func NewProfileHandler(profileStore store.ProfileStore, logger *log.Logger) *ProfileHandler {
+	return &ProfileHandler{
+		profileStore: profileStore,
+		logger:       logger,
+	}
+}
+
+func (ph *ProfileHandler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := ph.profileStore.GetProfile(middleware.GetUser(r).ID)
+	if err != nil {
+		ph.logger.Printf("Error:: Getting profile: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get profile",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"profile": profile,
+	})
+}
+
+// nullable is a field of a partial update that can be cleared: Set tells a
+// field sent as null, which leaves Value nil, from one that was left out.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	n.Value = new(T)
+	return json.Unmarshal(data, n.Value)
+}
+
+// HandleUpdateProfile changes the fields present in the request body and
+// leaves the others alone. The body measurements are cleared with null.
+func (ph *ProfileHandler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		WeightUnit   *string              `json:"weight_unit"`
+		DistanceUnit *string              `json:"distance_unit"`
+		DateOfBirth  nullable[store.Date] `json:"date_of_birth"`
+		HeightCm     nullable[float64]    `json:"height_cm"`
+		Sex          nullable[string]     `json:"sex"`
+		BodyWeightKg nullable[float64]    `json:"body_weight_kg"`
+		Timezone     *string              `json:"timezone"`
+		WeekStart    *string              `json:"week_start"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	profile, err := ph.profileStore.GetProfile(middleware.GetUser(r).ID)
+	if err != nil {
+		ph.logger.Printf("Error:: Getting profile: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to update profile",
+		})
+		return
+	}
+	if req.WeightUnit != nil {
+		profile.WeightUnit = *req.WeightUnit
+	}
+	if req.DistanceUnit != nil {
+		profile.DistanceUnit = *req.DistanceUnit
+	}
+	if req.DateOfBirth.Set {
+		profile.DateOfBirth = store.Date{}
+		if req.DateOfBirth.Value != nil {
+			profile.DateOfBirth = *req.DateOfBirth.Value
+		}
+	}
+	if req.HeightCm.Set {
+		profile.HeightCm = req.HeightCm.Value
+	}
+	if req.Sex.Set {
+		profile.Sex = req.Sex.Value
+	}
+	if req.BodyWeightKg.Set {
+		profile.BodyWeightKg = req.BodyWeightKg.Value
+	}
+	if req.Timezone != nil {
+		profile.Timezone = *req.Timezone
+	}
+	if req.WeekStart != nil {
+		profile.WeekStart = *req.WeekStart
+	}
+
+	err = ph.profileStore.UpdateProfile(profile)
+	if errors.Is(err, store.ErrInvalidProfile) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("Error:: Updating profile: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to update profile",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"profile": profile,
+	})
+}
+
+// profileOf loads the profile of the user of r, whose preferences other
+// handlers use as defaults. A failure is logged and the defaults are used.
+func profileOf(s store.ProfileStore, logger *log.Logger, r *http.Request) *store.UserProfile {
+	userID := middleware.GetUser(r).ID
+	profile, err := s.GetProfile(userID)
+	if err != nil {
+		logger.Printf("Error:: Getting profile: %v", err)
+		return store.DefaultProfile(userID)
+	}
+	return profile
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNullable(t *testing.T) {
+	var req struct {
+		HeightCm     nullable[float64] `json:"height_cm"`
+		Sex          nullable[string]  `json:"sex"`
+		BodyWeightKg nullable[float64] `json:"body_weight_kg"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"height_cm": 180.5, "sex": null}`), &req))
+
+	assert.True(t, req.HeightCm.Set)
+	require.NotNil(t, req.HeightCm.Value)
+	assert.Equal(t, 180.5, *req.HeightCm.Value)
+	assert.True(t, req.Sex.Set, "sent as null")
+	assert.Nil(t, req.Sex.Value)
+	assert.False(t, req.BodyWeightKg.Set, "left out")
+
+	assert.Error(t, json.Unmarshal([]byte(`{"height_cm": "tall"}`), &req))
+}
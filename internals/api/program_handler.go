@@ -0,0 +1,323 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/policy"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type ProgramHandler struct {
+	programStore  store.ProgramStore
+	templateStore store.TemplateStore
+	profileStore  store.ProfileStore
+	logger        *log.Logger
+}
+
+func NewProgramHandler(programStore store.ProgramStore, templateStore store.TemplateStore, profileStore store.ProfileStore, logger *log.Logger) *ProgramHandler {
+	return &ProgramHandler{
+		programStore:  programStore,
+		templateStore: templateStore,
+		profileStore:  profileStore,
+		logger:        logger,
+	}
+}
+
+func (ph *ProgramHandler) HandleGetPrograms(w http.ResponseWriter, r *http.Request) {
+	programs, err := ph.programStore.ListPrograms()
+	if err != nil {
+		ph.logger.Printf("Error:: Listing programs: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list programs",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"programs": programs,
+	})
+}
+
+func (ph *ProgramHandler) HandleGetProgramByID(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.readProgram(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"program": program,
+	})
+}
+
+func (ph *ProgramHandler) HandleCreateProgram(w http.ResponseWriter, r *http.Request) {
+	var program store.Program
+	err := json.NewDecoder(r.Body).Decode(&program)
+	if err != nil {
+		ph.logger.Printf("Error:: Decoding create program request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	program.UserID = middleware.GetUser(r).ID
+
+	created, err := ph.programStore.CreateProgram(&program)
+	if errors.Is(err, store.ErrInvalidProgram) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("Error:: Creating program: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to create program",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"program": created,
+	})
+}
+
+func (ph *ProgramHandler) HandleDeleteProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.readProgram(w, r)
+	if !ok {
+		return
+	}
+	if !policy.Can(middleware.GetUser(r), policy.Delete, program) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to delete this program",
+		})
+		return
+	}
+	err := ph.programStore.DeleteProgram(program.ID)
+	if err != nil {
+		ph.logger.Printf("Error:: Deleting program: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to delete program",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEnroll starts the program for the caller. The timezone defaults to
+// the profile's, and start_date to today in the timezone.
+func (ph *ProgramHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.readProgram(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		StartDate store.Date `json:"start_date"`
+		Timezone  string     `json:"timezone"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+				"error": "Invalid request body",
+			})
+			return
+		}
+	}
+	if req.Timezone == "" {
+		req.Timezone = profileOf(ph.profileStore, ph.logger, r).Timezone
+	}
+	loc, err := store.LoadTimezone(req.Timezone)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req.StartDate.IsZero() {
+		req.StartDate = store.DateIn(time.Now(), loc)
+	}
+
+	enrollment, err := ph.programStore.Enroll(&store.ProgramEnrollment{
+		UserID:    middleware.GetUser(r).ID,
+		ProgramID: program.ID,
+		StartDate: req.StartDate,
+		Timezone:  req.Timezone,
+	})
+	if errors.Is(err, store.ErrInvalidProgram) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, store.ErrAlreadyEnrolled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": "You are already enrolled in a program; leave it first",
+		})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("Error:: Enrolling in program: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to enroll in program",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"enrollment": enrollment,
+	})
+}
+
+func (ph *ProgramHandler) HandleGetMyProgram(w http.ResponseWriter, r *http.Request) {
+	enrollment, program, ok := ph.readEnrollment(w, r)
+	if !ok {
+		return
+	}
+	today, ok := ph.today(w, r, enrollment)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"enrollment": enrollment,
+		"program":    program,
+		"position":   enrollment.Position(program, today),
+		"adherence":  enrollment.Adherence(program, today),
+	})
+}
+
+// HandleGetToday returns the session prescribed for today, with the
+// progression rules applied to the day's template. Log it by creating a
+// workout with its program_day_id.
+func (ph *ProgramHandler) HandleGetToday(w http.ResponseWriter, r *http.Request) {
+	enrollment, program, ok := ph.readEnrollment(w, r)
+	if !ok {
+		return
+	}
+	today, ok := ph.today(w, r, enrollment)
+	if !ok {
+		return
+	}
+	position := enrollment.Position(program, today)
+	response := utils.Envelope{
+		"position": position,
+		"session":  nil,
+	}
+	if position.Session == nil {
+		utils.WriteJSON(w, http.StatusOK, response)
+		return
+	}
+
+	template, err := ph.templateStore.GetTemplateByID(position.Session.TemplateID)
+	if err != nil || template == nil {
+		ph.logger.Printf("Error:: Getting template %d for program day: %v", position.Session.TemplateID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get today's session",
+		})
+		return
+	}
+	title := position.Session.Title
+	if title == "" {
+		title = template.Name
+	}
+	session := map[string]any{
+		"program_day_id": position.Session.ID,
+		"title":          title,
+		"template_id":    template.ID,
+		"entries":        program.Prescribe(position.Week, template),
+		"completed":      false,
+		"workout_id":     nil,
+	}
+	if completion := enrollment.Completion(position.Session.ID); completion != nil {
+		session["completed"] = true
+		session["workout_id"] = completion.WorkoutID
+	}
+	response["session"] = session
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (ph *ProgramHandler) HandleLeaveProgram(w http.ResponseWriter, r *http.Request) {
+	enrollment, _, ok := ph.readEnrollment(w, r)
+	if !ok {
+		return
+	}
+	err := ph.programStore.CancelEnrollment(enrollment.ID)
+	if err != nil {
+		ph.logger.Printf("Error:: Cancelling enrollment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to leave program",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// today is the current calendar day in the ?tz= timezone, or the timezone
+// given at enrollment.
+func (ph *ProgramHandler) today(w http.ResponseWriter, r *http.Request, enrollment *store.ProgramEnrollment) (store.Date, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = enrollment.Timezone
+	}
+	loc, err := store.LoadTimezone(tz)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return store.Date{}, false
+	}
+	return store.DateIn(time.Now(), loc), true
+}
+
+func (ph *ProgramHandler) readProgram(w http.ResponseWriter, r *http.Request) (*store.Program, bool) {
+	programID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("Error:: Reading program ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid program ID",
+		})
+		return nil, false
+	}
+	program, err := ph.programStore.GetProgramByID(programID)
+	if err != nil {
+		ph.logger.Printf("Error:: Getting program by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get program",
+		})
+		return nil, false
+	}
+	if program == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "Program not found",
+		})
+		return nil, false
+	}
+	return program, true
+}
+
+// readEnrollment loads the caller's active enrollment and its program, and
+// writes a 404 when the caller is not enrolled.
+func (ph *ProgramHandler) readEnrollment(w http.ResponseWriter, r *http.Request) (*store.ProgramEnrollment, *store.Program, bool) {
+	enrollment, err := ph.programStore.GetActiveEnrollment(middleware.GetUser(r).ID)
+	if err != nil {
+		ph.logger.Printf("Error:: Getting active enrollment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get program",
+		})
+		return nil, nil, false
+	}
+	if enrollment == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "You are not enrolled in a program",
+		})
+		return nil, nil, false
+	}
+	program, err := ph.programStore.GetProgramByID(enrollment.ProgramID)
+	if err != nil || program == nil {
+		ph.logger.Printf("Error:: Getting enrolled program %d: %v", enrollment.ProgramID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get program",
+		})
+		return nil, nil, false
+	}
+	return enrollment, program, true
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/policy"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+)
+
+type RecordHandler struct {
+	recordStore store.RecordStore
+	logger      *log.Logger
+}
+
+func NewRecordHandler(recordStore store.RecordStore, logger *log.Logger) *RecordHandler {
+	return &RecordHandler{
+		recordStore: recordStore,
+		logger:      logger,
+	}
+}
+
+// HandleGetUserRecords lists a user's personal records, optionally for a
+// single ?exercise_id=.
+func (rh *RecordHandler) HandleGetUserRecords(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("Error:: Reading user ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+	if !policy.Can(middleware.GetUser(r), policy.Read, policy.RecordsOf(userID)) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to view these records",
+		})
+		return
+	}
+	exerciseID, err := utils.ReadIntQuery(r.URL.Query(), "exercise_id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	records, err := rh.recordStore.ListPersonalRecords(userID, exerciseID)
+	if err != nil {
+		rh.logger.Printf("Error:: Listing personal records: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list personal records",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"records": records,
+	})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+)
+
+type RoleHandler struct {
+	roleStore store.RoleStore
+	userStore store.UserStore
+	logger    *log.Logger
+}
+
+func NewRoleHandler(roleStore store.RoleStore, userStore store.UserStore, logger *log.Logger) *RoleHandler {
+	return &RoleHandler{
+		roleStore: roleStore,
+		userStore: userStore,
+		logger:    logger,
+	}
+}
+
+func (rh *RoleHandler) HandleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := rh.roleStore.ListRoles()
+	if err != nil {
+		rh.logger.Printf("Error:: Listing roles: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list roles",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"roles": roles,
+	})
+}
+
+// HandleSetUserRole changes the role of user {id}. Administrators cannot
+// change their own role, so there is always one left to undo a mistake.
+func (rh *RoleHandler) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("Error:: Reading user ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+	if userID == middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You cannot change your own role",
+		})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	found, err := rh.roleStore.SetUserRole(userID, req.Role)
+	if errors.Is(err, store.ErrUnknownRole) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		rh.logger.Printf("Error:: Setting user role: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to set role",
+		})
+		return
+	}
+	if !found {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "User not found",
+		})
+		return
+	}
+	rh.logger.Printf("User %d changed the role of user %d to %q", middleware.GetUser(r).ID, userID, req.Role)
+
+	user, err := rh.userStore.GetUserByID(userID)
+	if err != nil || user == nil {
+		rh.logger.Printf("Error:: Getting user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get user",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"user": user,
+	})
+}
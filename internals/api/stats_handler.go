@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type StatsHandler struct {
+	statsStore   store.StatsStore
+	profileStore store.ProfileStore
+	logger       *log.Logger
+}
+
+func NewStatsHandler(statsStore store.StatsStore, profileStore store.ProfileStore, logger *log.Logger) *StatsHandler {
+	return &StatsHandler{
+		statsStore:   statsStore,
+		profileStore: profileStore,
+		logger:       logger,
+	}
+}
+
+// readStatsFilter reads the from, to and bucket query parameters shared by
+// all stats endpoints. Weeks start on the profile's week start, and a range
+// without an end ends today in the profile's timezone.
+func (sh *StatsHandler) readStatsFilter(r *http.Request) (store.StatsFilter, error) {
+	qs := r.URL.Query()
+	profile := profileOf(sh.profileStore, sh.logger, r)
+	filter := store.StatsFilter{
+		UserID:    middleware.GetUser(r).ID,
+		Bucket:    qs.Get("bucket"),
+		WeekStart: profile.WeekStart,
+	}
+	var err error
+	if filter.From, err = utils.ReadDateQuery(qs, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = utils.ReadDateQuery(qs, "to"); err != nil {
+		return filter, err
+	}
+	filter.SetDefaultRange(store.DateIn(time.Now(), profile.Location()).Time)
+	return filter, nil
+}
+
+func (sh *StatsHandler) HandleGetSummary(w http.ResponseWriter, r *http.Request) {
+	filter, err := sh.readStatsFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	buckets, err := sh.statsStore.GetWorkoutSummary(filter)
+	if !sh.checkStatsError(w, err, "workout summary") {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"summary": buckets,
+	})
+}
+
+func (sh *StatsHandler) HandleGetVolume(w http.ResponseWriter, r *http.Request) {
+	filter, err := sh.readStatsFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	exerciseID, err := utils.ReadIntQuery(r.URL.Query(), "exercise_id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	buckets, err := sh.statsStore.GetVolume(filter, exerciseID)
+	if !sh.checkStatsError(w, err, "volume") {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"volume": buckets,
+	})
+}
+
+func (sh *StatsHandler) HandleGetExerciseProgress(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.logger.Printf("Error:: Reading exercise ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid exercise ID",
+		})
+		return
+	}
+	filter, err := sh.readStatsFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	points, err := sh.statsStore.GetExerciseProgress(filter, exerciseID)
+	if !sh.checkStatsError(w, err, "exercise progress") {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"progress": points,
+	})
+}
+
+func (sh *StatsHandler) HandleGetFrequency(w http.ResponseWriter, r *http.Request) {
+	filter, err := sh.readStatsFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	frequencies, err := sh.statsStore.GetExerciseFrequency(filter)
+	if !sh.checkStatsError(w, err, "exercise frequency") {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"frequency": frequencies,
+	})
+}
+
+// checkStatsError writes the error response for a failed stats query and
+// reports whether the handler can go on.
+func (sh *StatsHandler) checkStatsError(w http.ResponseWriter, err error, what string) bool {
+	if errors.Is(err, store.ErrInvalidBucket) || errors.Is(err, store.ErrInvalidStatsRange) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return false
+	}
+	if err != nil {
+		sh.logger.Printf("Error:: Getting %s: %v", what, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get " + what,
+		})
+		return false
+	}
+	return true
+}
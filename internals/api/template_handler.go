@@ -0,0 +1,304 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/policy"
+	"go_beginner/internals/store"
+	"go_beginner/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type TemplateHandler struct {
+	templateStore store.TemplateStore
+	workoutStore  store.WorkoutStore
+	logger        *log.Logger
+}
+
+func NewTemplateHandler(templateStore store.TemplateStore, workoutStore store.WorkoutStore, logger *log.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		workoutStore:  workoutStore,
+		logger:        logger,
+	}
+}
+
+func (th *TemplateHandler) HandleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := th.templateStore.ListTemplates(middleware.GetUser(r).ID)
+	if err != nil {
+		th.logger.Printf("Error:: Listing templates: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list templates",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"templates": templates,
+	})
+}
+
+func (th *TemplateHandler) HandleGetTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.readTemplate(w, r, policy.Read)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"template": template,
+	})
+}
+
+type templateRequest struct {
+	Name        *string               `json:"name"`
+	Description *string               `json:"description"`
+	Entries     []store.TemplateEntry `json:"entries"`
+}
+
+func (th *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("Error:: Decoding create template request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	template := &store.WorkoutTemplate{
+		UserID:  middleware.GetUser(r).ID,
+		Entries: req.Entries,
+	}
+	if req.Name != nil {
+		template.Name = *req.Name
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+	th.createTemplate(w, template)
+}
+
+// HandleCreateTemplateFromWorkout saves a workout the user can read, such as
+// an athlete's for a coach, as a template of the user. The optional body
+// {"name": ...} overrides the workout title.
+func (th *TemplateHandler) HandleCreateTemplateFromWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("Error:: Reading workout ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid workout ID",
+		})
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+				"error": "Invalid request body",
+			})
+			return
+		}
+	}
+
+	workout, err := th.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil {
+		th.logger.Printf("Error:: Getting workout by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get workout",
+		})
+		return
+	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "Workout not found",
+		})
+		return
+	}
+	if !policy.Can(middleware.GetUser(r), policy.Read, workout) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to use this workout",
+		})
+		return
+	}
+
+	th.createTemplate(w, store.NewTemplateFromWorkout(workout, middleware.GetUser(r).ID, req.Name))
+}
+
+func (th *TemplateHandler) createTemplate(w http.ResponseWriter, template *store.WorkoutTemplate) {
+	created, err := th.templateStore.CreateTemplate(template)
+	if errors.Is(err, store.ErrInvalidTemplate) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("Error:: Creating template: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to create template",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"template": created,
+	})
+}
+
+func (th *TemplateHandler) HandleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.readTemplate(w, r, policy.Update)
+	if !ok {
+		return
+	}
+
+	var req templateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("Error:: Decoding update template request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	if req.Name != nil {
+		template.Name = *req.Name
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+	if req.Entries != nil {
+		template.Entries = req.Entries
+	}
+
+	err = th.templateStore.UpdateTemplate(template)
+	if errors.Is(err, store.ErrInvalidTemplate) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("Error:: Updating template: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to update template",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"template": template,
+	})
+}
+
+func (th *TemplateHandler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.readTemplate(w, r, policy.Delete)
+	if !ok {
+		return
+	}
+	err := th.templateStore.DeleteTemplate(template.ID)
+	if errors.Is(err, store.ErrTemplateInUse) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": "Template is used by a program and cannot be deleted",
+		})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("Error:: Deleting template: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to delete template",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleStartWorkout creates a new workout from a template, pre-filled with
+// the weights from the last time the template was performed.
+func (th *TemplateHandler) HandleStartWorkout(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.readTemplate(w, r, policy.Read)
+	if !ok {
+		return
+	}
+	var req struct {
+		StartedAt *time.Time `json:"started_at"`
+		Timezone  string     `json:"timezone"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+				"error": "Invalid request body",
+			})
+			return
+		}
+	}
+	startedAt := time.Now()
+	if req.StartedAt != nil {
+		startedAt = *req.StartedAt
+	}
+
+	last, err := th.workoutStore.GetLatestWorkoutForTemplate(template.ID, template.UserID)
+	if err != nil {
+		th.logger.Printf("Error:: Getting last workout for template: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to start workout",
+		})
+		return
+	}
+
+	workout := store.NewWorkoutFromTemplate(template, last, startedAt)
+	workout.Timezone = req.Timezone
+	created, err := th.workoutStore.CreateWorkout(workout)
+	if errors.Is(err, store.ErrInvalidWorkout) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("Error:: Creating workout from template: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to start workout",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"workout": created,
+	})
+}
+
+// readTemplate loads the template from the {id} URL parameter and writes
+// the error response when it is missing or the caller may not perform action
+// on it.
+func (th *TemplateHandler) readTemplate(w http.ResponseWriter, r *http.Request, action policy.Action) (*store.WorkoutTemplate, bool) {
+	templateID, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("Error:: Reading template ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid template ID",
+		})
+		return nil, false
+	}
+	template, err := th.templateStore.GetTemplateByID(templateID)
+	if err != nil {
+		th.logger.Printf("Error:: Getting template by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get template",
+		})
+		return nil, false
+	}
+	if template == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "Template not found",
+		})
+		return nil, false
+	}
+	if !policy.Can(middleware.GetUser(r), action, template) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to access this template",
+		})
+		return nil, false
+	}
+	return template, true
+}
@@ -2,18 +2,25 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"go_beginner/internals/middleware"
 	"go_beginner/internals/store"
 	"go_beginner/internals/tokens"
 	"go_beginner/utils"
 	"log"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 )
 
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	tokenStore        store.TokenStore
+	userStore         store.UserStore
+	loginAttemptStore store.LoginAttemptStore
+	mfaStore          store.MFAStore
+	authEventStore    store.AuthEventStore
+	logger            *log.Logger
 }
 
 type createTokenRequest struct {
@@ -21,52 +28,203 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, loginAttemptStore store.LoginAttemptStore, mfaStore store.MFAStore, authEventStore store.AuthEventStore, logger *log.Logger) *TokenHandler {
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		tokenStore:        tokenStore,
+		userStore:         userStore,
+		loginAttemptStore: loginAttemptStore,
+		mfaStore:          mfaStore,
+		authEventStore:    authEventStore,
+		logger:            logger,
 	}
 }
 
+// HandleCreateToken logs a user in. Unknown emails and wrong passwords get the
+// same response after the same amount of work, and repeated failures per
+// account and per client are slowed down and eventually locked out.
 func  (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
 	var req createTokenRequest
 
 	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		h.logger.Printf("Error decoding request body: %v", err)
+	if err != nil || req.Email == "" || req.Password == "" {
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"Message": "Invalid request body",
+			"Message": "Email and password are required",
 		})
 		return
 	}
 
-	user, err := h.userStore.GetUserByEmail(req.Email)
-	if err != nil || user == nil {
-		h.logger.Printf("Error getting user by email: %v", err)
+	ip := utils.ClientIP(r)
+	accountKey := store.AccountLoginKey(req.Email)
+	ipKey := store.IPLoginKey(ip)
+	wait, err := h.loginAttemptStore.RetryAfter(accountKey, ipKey)
+	if err != nil {
+		h.logger.Printf("Error:: Checking login attempts: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"Message": "Failed to get user",
+			"Message": "Failed to log in",
 		})
 		return
 	}
-	println("Password",req.Password)
-	passwordMatch , err := user.PasswordHash.Check(req.Password)
+	if wait > 0 {
+		// Not an audit event: the failures that led here are recorded, and
+		// recording every throttled request would let a client grow the log
+		// without limit.
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{
+			"Message": "Too many failed login attempts, try again later",
+		})
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(req.Email)
 	if err != nil {
-		h.logger.Printf("Error : password match, %v", err)
+		h.logger.Printf("Error getting user by email: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"Message": "Failed to check password",
+			"Message": "Failed to log in",
 		})
 		return
 	}
+	passwordMatch := false
+	if user == nil {
+		store.CheckDummyPassword(req.Password)
+	} else {
+		passwordMatch, err = user.PasswordHash.Check(req.Password)
+		if err != nil {
+			h.logger.Printf("Error : password match, %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+				"Message": "Failed to log in",
+			})
+			return
+		}
+	}
 	if !passwordMatch {
-		h.logger.Printf("Password mismatch for user %s", req.Email)
+		event := store.AuthEvent{Email: req.Email, Type: store.AuthEventLoginFailed, Detail: "unknown email"}
+		if user != nil {
+			event.UserID, event.Detail = &user.ID, "wrong password"
+		}
+		recordAuthEvent(h.authEventStore, h.logger, r, event)
+		h.recordLoginFailure(accountKey, store.AccountLoginThrottle)
+		h.recordLoginFailure(ipKey, store.IPLoginThrottle)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
 			"Message": "Invalid email or password",
 		})
 		return
 	}
+	if user.PasswordHash.NeedsRehash() {
+		h.rehashPassword(user, req.Password)
+	}
+	h.startSession(w, r, user, accountKey, "password")
+}
 
-	token, err := h.tokenStore.CrateNewToken(int(user.ID), 24*time.Hour, tokens.ScopeAuth)
+// startSession logs in a user whose identity has been checked with method:
+// it asks for the second factor when the user has one, and issues tokens
+// otherwise.
+func (h *TokenHandler) startSession(w http.ResponseWriter, r *http.Request, user *store.User, accountKey string, method string) {
+	mfa, err := h.mfaStore.GetMFA(user.ID)
+	if err != nil {
+		h.logger.Printf("Error:: Getting two-factor setup: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"Message": "Failed to log in",
+		})
+		return
+	}
+	if mfa != nil && mfa.Enabled {
+		// The first factor was right, but the login only counts once the
+		// second factor is, so the failure counter is left alone.
+		challenge, err := h.tokenStore.CrateNewToken(user.ID, tokens.MFAChallengeTTL, tokens.ScopeMFAChallenge)
+		if err != nil {
+			h.logger.Printf("Error:: Creating MFA challenge: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+				"Message": "Failed to log in",
+			})
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+			"mfa_required":  true,
+			"mfa_challenge": challenge,
+		})
+		return
+	}
+	h.completeLogin(w, r, user, accountKey, method)
+}
+
+// HandleLoginMFA finishes a login with two-factor authentication: it
+// exchanges the challenge from /login and a TOTP or recovery code for tokens.
+// A challenge can be used once, so a wrong code means logging in again.
+func (h *TokenHandler) HandleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"mfa_challenge"`
+		Code      string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Challenge == "" || req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"Message": "mfa_challenge and code are required",
+		})
+		return
+	}
+
+	userID, err := h.tokenStore.ConsumeToken(tokens.ScopeMFAChallenge, req.Challenge)
+	if err != nil {
+		h.logger.Printf("Error:: Consuming MFA challenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"Message": "Failed to log in",
+		})
+		return
+	}
+	var user *store.User
+	if userID != 0 {
+		user, err = h.userStore.GetUserByID(userID)
+		if err != nil {
+			h.logger.Printf("Error:: Getting user by ID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+				"Message": "Failed to log in",
+			})
+			return
+		}
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
+			"Message": "Invalid or expired challenge, please log in again",
+		})
+		return
+	}
+
+	accountKey := store.AccountLoginKey(user.Email)
+	ipKey := store.IPLoginKey(utils.ClientIP(r))
+	valid, err := h.mfaStore.VerifyCode(user.ID, req.Code)
+	if err != nil {
+		h.logger.Printf("Error:: Verifying two-factor code: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"Message": "Failed to log in",
+		})
+		return
+	}
+	if !valid {
+		recordAuthEvent(h.authEventStore, h.logger, r, store.AuthEvent{
+			UserID: &user.ID,
+			Email:  user.Email,
+			Type:   store.AuthEventLoginFailed,
+			Detail: "wrong two-factor code",
+		})
+		h.recordLoginFailure(accountKey, store.AccountLoginThrottle)
+		h.recordLoginFailure(ipKey, store.IPLoginThrottle)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
+			"Message": "Invalid code, please log in again",
+		})
+		return
+	}
+	h.completeLogin(w, r, user, accountKey, "two-factor")
+}
+
+// completeLogin resets the failed login counter of the account and issues
+// the tokens of a new session.
+func (h *TokenHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User, accountKey string, method string) {
+	err := h.loginAttemptStore.Reset(accountKey)
+	if err != nil {
+		h.logger.Printf("Error:: Resetting login attempts: %v", err)
+	}
+
+	pair, err := h.tokenStore.CreateTokenPair(user.ID, utils.ClientIP(r), r.UserAgent())
 	if err != nil {
 		h.logger.Printf("Error creating new token: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
@@ -74,8 +232,160 @@ func  (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request
 		})
 		return
 	}
+	recordAuthEvent(h.authEventStore, h.logger, r, store.AuthEvent{
+		UserID: &user.ID,
+		Email:  user.Email,
+		Type:   store.AuthEventLoginSucceeded,
+		Detail: fmt.Sprintf("%s, session %d", method, pair.Access.FamilyID),
+	})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"token":         pair.Access,
+		"refresh_token": pair.Refresh,
+	})
+}
+
+// rehashPassword stores the password hashed with the current algorithm and
+// parameters. The login goes on if that fails; it is tried again next time.
+func (h *TokenHandler) rehashPassword(user *store.User, password string) {
+	err := user.PasswordHash.Set(password)
+	if err == nil {
+		err = h.userStore.UpdatePassword(user)
+	}
+	if err != nil {
+		h.logger.Printf("Error:: Rehashing password: %v", err)
+	}
+}
+
+func (h *TokenHandler) recordLoginFailure(key string, throttle store.LoginThrottle) {
+	failures, err := h.loginAttemptStore.RecordFailure(key, throttle)
+	if err != nil {
+		h.logger.Printf("Error:: Recording failed login: %v", err)
+		return
+	}
+	if throttle.Locks(failures) {
+		h.logger.Printf("Warning:: Login locked for %s after %d failed attempts, for %s", key, failures, throttle.LockoutFor)
+	}
+}
+
+// HandleRefreshToken exchanges a refresh token for a new access token and a
+// new refresh token. Each refresh token can only be used once.
+func (h *TokenHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	pair, err := h.tokenStore.UseRefreshToken(req.RefreshToken, utils.ClientIP(r), r.UserAgent())
+	if errors.Is(err, store.ErrRefreshTokenReused) {
+		h.logger.Printf("Warning:: Refresh token reused from %s, session revoked", utils.ClientIP(r))
+	}
+	if errors.Is(err, store.ErrInvalidRefreshToken) || errors.Is(err, store.ErrRefreshTokenReused) {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
+			"error": "Invalid or expired refresh token",
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error:: Refreshing token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to refresh token",
+		})
+		return
+	}
+	recordAuthEvent(h.authEventStore, h.logger, r, store.AuthEvent{
+		UserID: &pair.Access.UserID,
+		Type:   store.AuthEventTokenRefreshed,
+		Detail: fmt.Sprintf("session %d", pair.Access.FamilyID),
+	})
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
-		"token": token,
+		"token":         pair.Access,
+		"refresh_token": pair.Refresh,
 	})
 }
 
+// HandleLogout revokes the token the request was made with.
+func (h *TokenHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	err := h.tokenStore.DeleteToken(tokens.ScopeAuth, middleware.GetToken(r))
+	if err != nil {
+		h.logger.Printf("Error:: Revoking token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to log out",
+		})
+		return
+	}
+	h.recordRevocation(r, "logout")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleLogoutAll revokes every session of the user, including this one.
+func (h *TokenHandler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUser(r).ID
+	err := h.tokenStore.DeleteAllTokensForUser(userID, tokens.ScopeAuth)
+	if err == nil {
+		err = h.tokenStore.DeleteAllTokensForUser(userID, tokens.ScopeRefresh)
+	}
+	if err != nil {
+		h.logger.Printf("Error:: Revoking all tokens: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to log out",
+		})
+		return
+	}
+	h.recordRevocation(r, "all sessions")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TokenHandler) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.tokenStore.ListSessions(middleware.GetUser(r).ID, middleware.GetToken(r))
+	if err != nil {
+		h.logger.Printf("Error:: Listing sessions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to list sessions",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"sessions": sessions,
+	})
+}
+
+func (h *TokenHandler) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid session ID",
+		})
+		return
+	}
+	found, err := h.tokenStore.DeleteSession(middleware.GetUser(r).ID, sessionID)
+	if err != nil {
+		h.logger.Printf("Error:: Revoking session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to revoke session",
+		})
+		return
+	}
+	if !found {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "Session not found",
+		})
+		return
+	}
+	h.recordRevocation(r, fmt.Sprintf("session %d", sessionID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordRevocation logs that the user of r revoked what detail describes.
+func (h *TokenHandler) recordRevocation(r *http.Request, detail string) {
+	recordAuthEvent(h.authEventStore, h.logger, r, store.AuthEvent{
+		UserID: &middleware.GetUser(r).ID,
+		Type:   store.AuthEventTokenRevoked,
+		Detail: detail,
+	})
+}
@@ -3,40 +3,56 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"go_beginner/internals/mailer"
+	"go_beginner/internals/middleware"
+	"go_beginner/internals/passwords"
+	"go_beginner/internals/policy"
 	"go_beginner/internals/store"
+	"go_beginner/internals/tokens"
 	"go_beginner/utils"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore      store.UserStore
+	tokenStore     store.TokenStore
+	breached       *passwords.BreachedList
+	authEventStore store.AuthEventStore
+	mailer         mailer.Mailer
+	clientURL      string // base of the links in emails
+	logger         *log.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, breached *passwords.BreachedList, authEventStore store.AuthEventStore, mailer mailer.Mailer, clientURL string, logger *log.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:      userStore,
+		tokenStore:     tokenStore,
+		breached:       breached,
+		authEventStore: authEventStore,
+		mailer:         mailer,
+		clientURL:      clientURL,
+		logger:         logger,
 	}
 }
 
 func (uh *UserHandler) HandleGetUserByID(w http.ResponseWriter, r *http.Request) {
-	userId, err := utils.ReadIDParam(r)
-	if err != nil {
-		uh.logger.Printf("Error:: Reading user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-	user, err := uh.userStore.GetUserByID(userId)
-	if err != nil {
-		uh.logger.Printf("Error:: Getting user by ID: %v", err)
-		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+	user, ok := uh.readUser(w, r, policy.Read)
+	if !ok {
 		return
 	}
-	if user == nil {
-		uh.logger.Printf("Error:: User not found for ID: %d", userId)
-		http.Error(w, "User not found", http.StatusNotFound)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"user": user,
+	})
+}
+
+// HandleGetMe returns the authenticated user.
+func (uh *UserHandler) HandleGetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := uh.readMe(w, r)
+	if !ok {
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
@@ -83,6 +99,12 @@ func (uh *UserHandler) HandleCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	createdUser, err := uh.userStore.CreateUser(user)
+	if errors.Is(err, store.ErrDuplicateEmail) || errors.Is(err, store.ErrDuplicateName) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		uh.logger.Printf("Error:: Creating user: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
@@ -90,27 +112,94 @@ func (uh *UserHandler) HandleCreateUser(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+
+	err = uh.sendActivationMail(createdUser)
+	if err != nil {
+		uh.logger.Printf("Error:: Creating activation token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to create user",
+		})
+		return
+	}
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
 		"user": createdUser,
 	})
 }
 
-func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	userId, err := utils.ReadIDParam(r)
+// HandleActivateUser confirms the email address of the account an activation
+// token was sent to.
+func (uh *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		uh.logger.Printf("Error:: Reading user ID: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "Invalid user ID",
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	userID, err := uh.tokenStore.ConsumeToken(tokens.ScopeActivation, req.Token)
+	if err != nil {
+		uh.logger.Printf("Error:: Consuming activation token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to activate user",
+		})
+		return
+	}
+	if userID == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid or expired activation token",
+		})
+		return
+	}
+	err = uh.userStore.ActivateUser(userID)
+	if err != nil {
+		uh.logger.Printf("Error:: Activating user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to activate user",
 		})
 		return
 	}
-	type UpdateUserRequest struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
-		Bio   string `json:"bio"`
+	user, err := uh.userStore.GetUserByID(userID)
+	if err != nil || user == nil {
+		uh.logger.Printf("Error:: Getting activated user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to activate user",
+		})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"user": user,
+	})
+}
+
+func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := uh.readUser(w, r, policy.Update)
+	if !ok {
+		return
+	}
+	uh.updateUser(w, r, user)
+}
+
+func (uh *UserHandler) HandleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := uh.readMe(w, r)
+	if !ok {
+		return
+	}
+	uh.updateUser(w, r, user)
+}
+
+// updateUser changes the fields present in the request body and leaves the
+// others alone. A new email address has to be confirmed again.
+func (uh *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, user *store.User) {
+	var req struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+		Bio   *string `json:"bio"`
 	}
-	var req UpdateUserRequest
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		uh.logger.Printf("Error:: Decoding update user request body: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
@@ -118,13 +207,33 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
-	user := &store.User{
-		ID:    userId,
-		Name:  req.Name,
-		Email: req.Email,
-		Bio:   req.Bio,
+	if err := validateUpdateUserRequest(req.Name, req.Email); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	emailChanged := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if emailChanged {
+		user.Activated = false
+	}
+	err = uh.userStore.UpdateUser(user.ID, user)
+	if errors.Is(err, store.ErrDuplicateEmail) || errors.Is(err, store.ErrDuplicateName) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
 	}
-	err = uh.userStore.UpdateUser(userId, user)
 	if err != nil {
 		uh.logger.Printf("Error:: Updating user: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
@@ -132,21 +241,57 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+	if emailChanged {
+		err = uh.sendActivationMail(user)
+		if err != nil {
+			// The address has changed either way; a new activation
+			// email can be had by setting it again.
+			uh.logger.Printf("Error:: Sending activation email: %v", err)
+		}
+	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
 		"user": user,
 	})
 }
 
-func (uh *UserHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
-	userId, err := utils.ReadIDParam(r)
+// activationPagePath is the page of the client that the activation email
+// links to. It sends the token of the link to PUT /users/activated.
+const activationPagePath = "/activate"
+
+// sendActivationMail mails a link that confirms the user's email address.
+func (uh *UserHandler) sendActivationMail(user *store.User) error {
+	token, err := uh.tokenStore.CrateNewToken(user.ID, tokens.ActivationTokenTTL, tokens.ScopeActivation)
 	if err != nil {
-		uh.logger.Printf("Error:: Reading user ID: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "Invalid user ID",
-		})
+		return err
+	}
+	sendMail(uh.mailer, uh.logger, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address with this link:\n\n"+
+			"%s%s?token=%s\n\nThe link expires in %d days.\n", user.Name, uh.clientURL, activationPagePath,
+			url.QueryEscape(token.PlainText), int(tokens.ActivationTokenTTL.Hours()/24)),
+	})
+	return nil
+}
+
+func (uh *UserHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := uh.readUser(w, r, policy.Delete)
+	if !ok {
 		return
 	}
-	err = uh.userStore.DeleteUser(userId)
+	uh.deleteUser(w, r, user)
+}
+
+func (uh *UserHandler) HandleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := uh.readMe(w, r)
+	if !ok {
+		return
+	}
+	uh.deleteUser(w, r, user)
+}
+
+func (uh *UserHandler) deleteUser(w http.ResponseWriter, r *http.Request, user *store.User) {
+	err := uh.userStore.DeleteUser(user.ID)
 	if err != nil {
 		uh.logger.Printf("Error:: Deleting user: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
@@ -154,11 +299,79 @@ func (uh *UserHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+	event := store.AuthEvent{UserID: &user.ID, Email: user.Email, Type: store.AuthEventAccountDeleted}
+	if deletedBy := middleware.GetUser(r).ID; deletedBy != user.ID {
+		event.Detail = fmt.Sprintf("by user %d", deletedBy)
+	}
+	recordAuthEvent(uh.authEventStore, uh.logger, r, event)
 	w.WriteHeader(http.StatusNoContent) // 204 No Content
 }
 
+// readMe loads the authenticated user. The user in the request context may
+// only carry the fields of a signed token.
+func (uh *UserHandler) readMe(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	user, err := uh.userStore.GetUserByID(middleware.GetUser(r).ID)
+	if err != nil {
+		uh.logger.Printf("Error:: Getting user by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get user",
+		})
+		return nil, false
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "User not found",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// readUser loads the user from the {id} URL parameter and writes the error
+// response when it is missing or the caller may not perform action on it.
+func (uh *UserHandler) readUser(w http.ResponseWriter, r *http.Request, action policy.Action) (*store.User, bool) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		uh.logger.Printf("Error:: Reading user ID: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "Invalid user ID",
+		})
+		return nil, false
+	}
+	user, err := uh.userStore.GetUserByID(userID)
+	if err != nil {
+		uh.logger.Printf("Error:: Getting user by ID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
+			"error": "Failed to get user",
+		})
+		return nil, false
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
+			"error": "User not found",
+		})
+		return nil, false
+	}
+	if !policy.Can(middleware.GetUser(r), action, user) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to access this user",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// HandleGetUsers lists and searches users for administrators.
 func (uh *UserHandler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := uh.userStore.GetUsers()
+	filter, err := readUserFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	users, err := uh.userStore.GetUsers(filter)
 	if err != nil {
 		uh.logger.Printf("Error:: Getting users: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
@@ -171,6 +384,37 @@ func (uh *UserHandler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func readUserFilter(qs url.Values) (store.UserFilter, error) {
+	filter := store.UserFilter{
+		Search: qs.Get("q"),
+		Role:   qs.Get("role"),
+		Limit:  50,
+	}
+	limit, err := utils.ReadIntQuery(qs, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit != nil {
+		if *limit < 1 || *limit > 100 {
+			return filter, errors.New("limit must be between 1 and 100")
+		}
+		filter.Limit = *limit
+	}
+	offset, err := utils.ReadIntQuery(qs, "offset")
+	if err != nil {
+		return filter, err
+	}
+	if offset != nil {
+		if *offset < 0 {
+			return filter, errors.New("offset must not be negative")
+		}
+		filter.Offset = *offset
+	}
+	return filter, nil
+}
+
+const emailRegex = `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
+
 func (uh *UserHandler) validateRegisterRequest(req *createUserRequest) error {
 	if req.Name == "" {
 		return errors.New("name is required")
@@ -178,18 +422,41 @@ func (uh *UserHandler) validateRegisterRequest(req *createUserRequest) error {
 	if req.Email == "" {
 		return errors.New("email is required")
 	}
-	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
 	if !utils.MatchRegex(emailRegex, req.Email) {
 		return errors.New("invalid email format")
 	}
-	if req.Password == "" {
+	if err := validatePassword(req.Password, uh.breached); err != nil {
+		return err
+	}
+	if req.Bio == "" {
+		return errors.New("bio is required")
+	}
+	return nil
+}
+
+// validateUpdateUserRequest checks the fields of a partial update that are
+// set, by the rules of registration. Unlike at registration the bio may be
+// cleared.
+func validateUpdateUserRequest(name, email *string) error {
+	if name != nil && *name == "" {
+		return errors.New("name must not be empty")
+	}
+	if email != nil && !utils.MatchRegex(emailRegex, *email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+// validatePassword checks a new password. breached may be nil.
+func validatePassword(password string, breached *passwords.BreachedList) error {
+	if password == "" {
 		return errors.New("password is required")
 	}
-	if len(req.Password) < 6 {
+	if len(password) < 6 {
 		return errors.New("password must be at least 6 characters long")
 	}
-	if req.Bio == "" {
-		return errors.New("bio is required")
+	if breached.Contains(password) {
+		return errors.New("this password has appeared in a data breach, please choose another one")
 	}
 	return nil
 }
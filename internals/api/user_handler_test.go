@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUpdateUserRequest(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		userName *string
+		email    *string
+		wantErr  bool
+	}{
+		{name: "nothing to change"},
+		{name: "new name and email", userName: str("jane"), email: str("jane@example.com")},
+		{name: "empty name", userName: str(""), wantErr: true},
+		{name: "invalid email", email: str("jane@"), wantErr: true},
+		{name: "empty email", email: str(""), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUpdateUserRequest(tt.userName, tt.email)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -3,22 +3,28 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go_beginner/internals/middleware"
+	"go_beginner/internals/policy"
 	"go_beginner/internals/store"
 	"go_beginner/utils"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 type WorkoutHandler struct {
 	workoutStore store.WorkoutStore
+	profileStore store.ProfileStore
 	logger       *log.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, profileStore store.ProfileStore, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		workoutStore: workoutStore,
+		profileStore: profileStore,
 		logger:       logger,
 	}
 }
@@ -41,6 +47,12 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 		http.Error(w, fmt.Sprintf("Workout not found for ID: %d", workoutID), http.StatusNotFound)
 		return
 	}
+	if !policy.Can(middleware.GetUser(r), policy.Read, workout) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to view this workout",
+		})
+		return
+	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
 		"workout": workout,
 	})
@@ -66,7 +78,23 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 	fmt.Printf("User ID in CreateWorkout: %d\n", currentUser.ID)
 	workout.UserId = int(currentUser.ID)
 
+	// The timezone defaults to the profile's, and without calories the
+	// profile's body weight gives an estimate.
+	profile := profileOf(wh.profileStore, wh.logger, r)
+	if workout.Timezone == "" {
+		workout.Timezone = profile.Timezone
+	}
+	if workout.CaloriesBurned == 0 && profile.BodyWeightKg != nil {
+		workout.CaloriesBurned = store.EstimateCalories(workout.Duration(), *profile.BodyWeightKg)
+	}
+
 	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+	if errors.Is(err, store.ErrInvalidWorkout) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("Error:: Creating workout: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to create workout: %v", err), http.StatusInternalServerError)
@@ -95,15 +123,7 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
-			"error": "Unauthorized: Please log in to update a workout",
-		})
-		return
-	}
-
-	if existingWorkout.UserId != int(currentUser.ID) {
+	if !policy.Can(middleware.GetUser(r), policy.Update, existingWorkout) {
 		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
 			"error": "Forbidden: You do not have permission to update this workout",
 		})
@@ -115,6 +135,10 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		Description     *string              `json:"description"` // in seconds
 		DurationMinutes *int                 `json:"duration_minutes"`
 		CaloriesBurned  *int                 `json:"calories_burned"`
+		PerformedAt     *time.Time           `json:"performed_at"`
+		StartedAt       *time.Time           `json:"started_at"`
+		EndedAt         *time.Time           `json:"ended_at"`
+		Timezone        *string              `json:"timezone"`
 		Entries         []store.WorkoutEntry `json:"entries"`
 	}
 	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
@@ -135,32 +159,35 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 	if updateWorkoutRequest.CaloriesBurned != nil {
 		existingWorkout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
 	}
+	if updateWorkoutRequest.StartedAt != nil {
+		existingWorkout.StartedAt = updateWorkoutRequest.StartedAt
+	}
+	if updateWorkoutRequest.EndedAt != nil {
+		existingWorkout.EndedAt = updateWorkoutRequest.EndedAt
+	}
+	// A new start or end derives the duration again, but only when both are
+	// known; otherwise the stored duration is kept.
+	if updateWorkoutRequest.DurationMinutes == nil && (updateWorkoutRequest.StartedAt != nil || updateWorkoutRequest.EndedAt != nil) &&
+		existingWorkout.StartedAt != nil && existingWorkout.EndedAt != nil {
+		existingWorkout.DurationMinutes = 0
+	}
+	if updateWorkoutRequest.PerformedAt != nil {
+		existingWorkout.PerformedAt = *updateWorkoutRequest.PerformedAt
+	}
+	if updateWorkoutRequest.Timezone != nil {
+		existingWorkout.Timezone = *updateWorkoutRequest.Timezone
+	}
 	if updateWorkoutRequest.Entries != nil {
 		existingWorkout.Entries = updateWorkoutRequest.Entries
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwnerId(workoutID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
-				"error": "Workout not found",
-			})
-			return
-		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"error": fmt.Sprintf("Failed to get workout owner: %v", err),
-		})
-		return
-	}
-
-	if workoutOwner != int(currentUser.ID) {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
-			"error": "Forbidden: You do not have permission to update this workout",
+	err = wh.workoutStore.UpdateWorkout(workoutID, existingWorkout)
+	if errors.Is(err, store.ErrInvalidWorkout) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
 		})
 		return
 	}
-
-	err = wh.workoutStore.UpdateWorkout(workoutID, existingWorkout)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update workout: %v", err), http.StatusInternalServerError)
 		return
@@ -195,14 +222,7 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{
-			"error": "Unauthorized: Please log in to delete a workout",
-		})
-		return
-	}
-	if workout.UserId != int(currentUser.ID) {
+	if !policy.Can(middleware.GetUser(r), policy.Delete, workout) {
 		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
 			"error": "Forbidden: You do not have permission to delete this workout",
 		})
@@ -221,19 +241,90 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 }
 
 func (wh *WorkoutHandler) HandleGetAllWorkouts(w http.ResponseWriter, r *http.Request) {
-	workouts, err := wh.workoutStore.GetWorkouts()
+	currentUser := middleware.GetUser(r)
+	filter, err := readWorkoutFilter(r.URL.Query())
 	if err != nil {
-		wh.logger.Printf("Error:: Getting all workouts: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to get all workouts: %v", err), http.StatusInternalServerError)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
 		return
 	}
-	if len(workouts) == 0 {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
-			"message": "No workouts found",
+	if filter.UserID == 0 {
+		filter.UserID = currentUser.ID
+	}
+	if !policy.Can(currentUser, policy.Read, policy.WorkoutsOf(filter.UserID)) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{
+			"error": "Forbidden: You do not have permission to list these workouts",
 		})
 		return
 	}
+
+	page, err := wh.workoutStore.ListWorkouts(filter)
+	if errors.Is(err, store.ErrInvalidSort) || errors.Is(err, store.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("Error:: Listing workouts: %v", err)
+		http.Error(w, "Failed to list workouts", http.StatusInternalServerError)
+		return
+	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
-		"workouts": workouts,
+		"workouts": page.Workouts,
+		"metadata": utils.Envelope{
+			"next_cursor": page.NextCursor,
+			"total_count": page.TotalCount,
+			"limit":       filter.Limit,
+		},
 	})
 }
+
+func readWorkoutFilter(qs url.Values) (store.WorkoutFilter, error) {
+	filter := store.WorkoutFilter{
+		Search: qs.Get("q"),
+		Sort:   qs.Get("sort"),
+		Cursor: qs.Get("cursor"),
+		Limit:  store.DefaultWorkoutPageSize,
+	}
+	owner, err := utils.ReadIntQuery(qs, "user_id")
+	if err != nil {
+		return filter, err
+	}
+	if owner != nil {
+		filter.UserID = *owner
+	}
+	limit, err := utils.ReadIntQuery(qs, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit != nil {
+		if *limit < 1 || *limit > store.MaxWorkoutPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", store.MaxWorkoutPageSize)
+		}
+		filter.Limit = *limit
+	}
+	if filter.From, err = utils.ReadDateQuery(qs, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = utils.ReadDateQuery(qs, "to"); err != nil {
+		return filter, err
+	}
+	if filter.ExerciseID, err = utils.ReadIntQuery(qs, "exercise_id"); err != nil {
+		return filter, err
+	}
+	if filter.MinDuration, err = utils.ReadIntQuery(qs, "min_duration"); err != nil {
+		return filter, err
+	}
+	if filter.MaxDuration, err = utils.ReadIntQuery(qs, "max_duration"); err != nil {
+		return filter, err
+	}
+	if filter.MinCalories, err = utils.ReadIntQuery(qs, "min_calories"); err != nil {
+		return filter, err
+	}
+	if filter.MaxCalories, err = utils.ReadIntQuery(qs, "max_calories"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
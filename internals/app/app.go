@@ -4,12 +4,17 @@ import (
 	"database/sql"
 	"fmt"
 	"go_beginner/internals/api"
+	"go_beginner/internals/mailer"
 	"go_beginner/internals/middleware"
+	"go_beginner/internals/oidc"
+	"go_beginner/internals/passwords"
 	"go_beginner/internals/store"
+	"go_beginner/internals/tokens"
 	"go_beginner/migrations"
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
 type Application struct {
@@ -18,6 +23,20 @@ type Application struct {
 	UserHandler *api.UserHandler
 	DB *sql.DB 
 	TokenHandler *api.TokenHandler
+	ExerciseHandler *api.ExerciseHandler
+	TemplateHandler *api.TemplateHandler
+	ProgramHandler *api.ProgramHandler
+	RecordHandler *api.RecordHandler
+	StatsHandler *api.StatsHandler
+	GoalHandler *api.GoalHandler
+	PasswordHandler *api.PasswordHandler
+	RoleHandler *api.RoleHandler
+	MFAHandler *api.MFAHandler
+	APIKeyHandler *api.APIKeyHandler
+	// OIDCHandler is nil unless OIDC_ISSUER is set.
+	OIDCHandler *api.OIDCHandler
+	AuthEventHandler *api.AuthEventHandler
+	ProfileHandler *api.ProfileHandler
 	Middleware middleware.UserMiddleware
 }
  
@@ -33,19 +52,146 @@ func NewApplication() (*Application , error) {
 	}
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
-	tokenStore := store.NewPostgresTokenStore(pgDB)
-	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	tokenStore, tokenVerifier, err := newTokenStore(pgDB, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure tokens: %w", err)
+	}
+	exerciseStore := store.NewPostgresExerciseStore(pgDB)
+	templateStore := store.NewPostgresTemplateStore(pgDB)
+	programStore := store.NewPostgresProgramStore(pgDB)
+	recordStore := store.NewPostgresRecordStore(pgDB)
+	statsStore := store.NewPostgresStatsStore(pgDB)
+	goalStore := store.NewPostgresGoalStore(pgDB)
+	roleStore := store.NewPostgresRoleStore(pgDB)
+	loginAttemptStore := store.NewPostgresLoginAttemptStore(pgDB)
+	mfaStore := store.NewPostgresMFAStore(pgDB)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	oidcStore := store.NewPostgresOIDCStore(pgDB)
+	authEventStore := store.NewPostgresAuthEventStore(pgDB)
+	profileStore := store.NewPostgresProfileStore(pgDB)
+	breached, err := configurePasswords(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure passwords: %w", err)
+	}
+	mail, err := mailer.FromEnv(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure mailer: %w", err)
+	}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+	// The links in emails open pages of the web client, which can be served
+	// from elsewhere than the API.
+	clientURL := os.Getenv("CLIENT_URL")
+	if clientURL == "" {
+		clientURL = appURL
+	}
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, loginAttemptStore, mfaStore, authEventStore, logger)
+	var oidcHandler *api.OIDCHandler
+	provider, err := newOIDCProvider(appURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure OIDC: %w", err)
+	}
+	if provider != nil {
+		oidcHandler = api.NewOIDCHandler(provider, oidcStore, userStore, tokenHandler, logger)
+	}
+	middlewareHandler := middleware.UserMiddleware{UserStore: userStore, APIKeyStore: apiKeyStore, TokenVerifier: tokenVerifier}
 	app := &Application{
 		Logger: logger,
-		WorkoutHandler:  api.NewWorkoutHandler(workoutStore, logger),
-		UserHandler: api.NewUserHandler(userStore, logger),
-		TokenHandler: api.NewTokenHandler(tokenStore, userStore, logger),
+		WorkoutHandler:  api.NewWorkoutHandler(workoutStore, profileStore, logger),
+		UserHandler: api.NewUserHandler(userStore, tokenStore, breached, authEventStore, mail, clientURL, logger),
+		TokenHandler: tokenHandler,
+		ExerciseHandler: api.NewExerciseHandler(exerciseStore, logger),
+		TemplateHandler: api.NewTemplateHandler(templateStore, workoutStore, logger),
+		ProgramHandler: api.NewProgramHandler(programStore, templateStore, profileStore, logger),
+		RecordHandler: api.NewRecordHandler(recordStore, logger),
+		StatsHandler: api.NewStatsHandler(statsStore, profileStore, logger),
+		GoalHandler: api.NewGoalHandler(goalStore, profileStore, logger),
+		PasswordHandler: api.NewPasswordHandler(userStore, tokenStore, loginAttemptStore, breached, authEventStore, mail, clientURL, logger),
+		RoleHandler: api.NewRoleHandler(roleStore, userStore, logger),
+		MFAHandler: api.NewMFAHandler(mfaStore, userStore, loginAttemptStore, authEventStore, logger),
+		APIKeyHandler: api.NewAPIKeyHandler(apiKeyStore, logger),
+		OIDCHandler: oidcHandler,
+		AuthEventHandler: api.NewAuthEventHandler(authEventStore, logger),
+		ProfileHandler: api.NewProfileHandler(profileStore, logger),
 		DB: pgDB,
 		Middleware: middlewareHandler,
 	}
 	return app, nil
 }
    
+// newTokenStore picks how access tokens work from TOKEN_MODE: "database"
+// (the default) stores them, "signed" signs them with TOKEN_SIGNING_KEYS so
+// that requests are authenticated without a database lookup.
+func newTokenStore(db *sql.DB, logger *log.Logger) (store.TokenStore, middleware.TokenVerifier, error) {
+	switch mode := os.Getenv("TOKEN_MODE"); mode {
+	case "", "database":
+		return store.NewPostgresTokenStore(db), nil, nil
+	case "signed":
+		signer, err := tokens.ParseSigningKeys(os.Getenv("TOKEN_SIGNING_KEYS"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("TOKEN_SIGNING_KEYS: %w", err)
+		}
+		signed, err := store.NewSignedTokenStore(db, signer)
+		if err != nil {
+			return nil, nil, err
+		}
+		signed.WatchRevocations(30*time.Second, logger)
+		return signed, signed, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown TOKEN_MODE %q", mode)
+	}
+}
+
+// configurePasswords sets how new passwords are hashed (see
+// passwords.FromEnv) and loads the breached-password list named by
+// PASSWORD_BREACHED_LIST, if any.
+func configurePasswords(logger *log.Logger) (*passwords.BreachedList, error) {
+	hasher, err := passwords.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	err = store.SetPasswordHasher(hasher)
+	if err != nil {
+		return nil, err
+	}
+	path := os.Getenv("PASSWORD_BREACHED_LIST")
+	if path == "" {
+		return nil, nil
+	}
+	breached, err := passwords.LoadBreachedList(path)
+	if err != nil {
+		return nil, fmt.Errorf("PASSWORD_BREACHED_LIST: %w", err)
+	}
+	logger.Printf("Loaded %d breached passwords from %s", breached.Len(), path)
+	return breached, nil
+}
+
+// newOIDCProvider configures login with an OpenID Connect provider from
+// OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL. It
+// returns nil when OIDC_ISSUER is not set.
+func newOIDCProvider(appURL string) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = appURL + "/login/oidc/callback"
+	}
+	return oidc.New(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+	}), nil
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter , r *http.Request){
 	fmt.Fprintf(w, "All good!\n")
 }
\ No newline at end of file
@@ -0,0 +1,100 @@
+// Package mailer sends the account emails (password resets, activation
+// links) of the app.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer delivers messages through an SMTP server, using STARTTLS when the
+// server offers it.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	err := smtp.SendMail(addr, auth, m.From, []string{msg.To}, m.format(msg))
+	if err != nil {
+		return fmt.Errorf("sending mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+func (m *SMTPMailer) format(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// LogMailer writes messages to a logger instead of sending them, for
+// development and tests. Point the logger at a file to keep the messages.
+type LogMailer struct {
+	Logger *log.Logger
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.Logger.Printf("Mail:: To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FromEnv returns an SMTPMailer when SMTP_HOST is set, configured by
+// SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM.
+// Otherwise messages go to the given logger.
+func FromEnv(logger *log.Logger) (Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return &LogMailer{Logger: logger}, nil
+	}
+	port := 587
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		var err error
+		port, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT %q", value)
+		}
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("MAIL_FROM is required when SMTP_HOST is set")
+	}
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}, nil
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPMailerFormat(t *testing.T) {
+	m := &SMTPMailer{From: "noreply@example.com"}
+	raw := string(m.format(Message{To: "alice@example.com", Subject: "Hi", Body: "line 1\nline 2"}))
+
+	headers, body, found := strings.Cut(raw, "\r\n\r\n")
+	assert.True(t, found)
+	assert.Contains(t, headers, "From: noreply@example.com\r\n")
+	assert.Contains(t, headers, "To: alice@example.com\r\n")
+	assert.Contains(t, headers, "Subject: Hi\r\n")
+	assert.Equal(t, "line 1\r\nline 2", body)
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := &LogMailer{Logger: log.New(&buf, "", 0)}
+	assert.NoError(t, m.Send(Message{To: "alice@example.com", Subject: "Reset", Body: "token"}))
+	assert.Contains(t, buf.String(), "To: alice@example.com")
+	assert.Contains(t, buf.String(), "token")
+}
@@ -11,13 +11,26 @@ import (
 )
 
 
+// TokenVerifier checks signed access tokens without a database lookup.
+type TokenVerifier interface {
+	VerifyAccessToken(token string) (*store.User, error)
+}
+
 type UserMiddleware struct {
 	UserStore store.UserStore 
+	APIKeyStore store.APIKeyStore
+	// TokenVerifier is set when access tokens are signed (TOKEN_MODE=signed).
+	TokenVerifier TokenVerifier
 }
 
 type ContextKey string
 
 const UserContextKey ContextKey = "user"
+const TokenContextKey ContextKey = "token"
+const APIKeyContextKey ContextKey = "api_key"
+
+// scopeCheckedContextKey marks requests whose API key passed RequireScope.
+const scopeCheckedContextKey ContextKey = "scope_checked"
 
 func SetUser(r *http.Request, user *store.User) *http.Request{
 	ctx := context.WithValue(r.Context(), UserContextKey , user)
@@ -33,6 +46,19 @@ func GetUser(r *http.Request) *store.User{
 	return user
 }
 
+// GetToken returns the bearer token the request was authenticated with.
+func GetToken(r *http.Request) string {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	return token
+}
+
+// GetAPIKey returns the API key the request was authenticated with, nil for
+// requests with a login token.
+func GetAPIKey(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return key
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -50,6 +76,30 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		token := headerParts[1]
+		if strings.HasPrefix(token, store.APIKeyPrefix) {
+			user, key, err := um.APIKeyStore.GetUserForAPIKey(token)
+			if err != nil || user == nil {
+				utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"Error": "Invalid or expired API key"})
+				return
+			}
+			r = SetUser(r, user)
+			r = r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, key))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if um.TokenVerifier != nil && tokens.IsSigned(token) {
+			user, err := um.TokenVerifier.VerifyAccessToken(token)
+			if err != nil {
+				utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"Error": "Invalid or expired token"})
+				return
+			}
+			r = SetUser(r, user)
+			r = r.WithContext(context.WithValue(r.Context(), TokenContextKey, token))
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
 		if err != nil {
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"Error": "Invalid or expired token"})
@@ -62,6 +112,7 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		r = SetUser(r, user)
+		r = r.WithContext(context.WithValue(r.Context(), TokenContextKey, token))
 		next.ServeHTTP(w, r)
 	})
 }
@@ -73,7 +124,55 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"Error": "You must be logged in to access this resource"})
 			return
 		}
+		// API keys only reach routes that name the scope they need.
+		if GetAPIKey(r) != nil && r.Context().Value(scopeCheckedContextKey) == nil {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"Error": "This resource is not available to API keys"})
+			return
+		}
 		fmt.Printf("User ID in RequireUser middleware: %+v\n", user)
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireActivatedUser is RequireUser for actions that need a confirmed email
+// address.
+func (um *UserMiddleware) RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if !user.Activated {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"Error": "You must confirm your email address to access this resource"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission is RequireUser for routes that need a permission granted
+// by the user's role.
+func (um *UserMiddleware) RequirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if !user.Permissions.Include(permission) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"Error": "You do not have permission to access this resource"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope lets requests made with an API key through to next only when
+// the key has scope. Requests with a login token are not limited by scopes.
+// next still has to require a user, e.g. with RequireUser.
+func (um *UserMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := GetAPIKey(r)
+		if key != nil {
+			if !key.HasScope(scope) {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"Error": fmt.Sprintf("This API key is missing the %s scope", scope)})
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), scopeCheckedContextKey, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,367 @@
+// Package oidc implements the parts of OpenID Connect needed to log users in
+// with an external identity provider: discovery, the authorization code flow
+// with PKCE, and validation of RS256 ID tokens against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is how far the clocks of the provider and ours may differ.
+const clockSkew = time.Minute
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes default to openid, email and profile.
+	Scopes []string
+	// HTTPClient defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// Metadata is the subset of the discovery document we use.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims we use.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience is a single string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// flexBool accepts true as well as "true", which some providers send.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// Provider talks to one identity provider. Discovery happens on first use,
+// so the app can start while the provider is unreachable.
+type Provider struct {
+	config Config
+
+	// mu guards the cached documents. It is never held during a request to
+	// the provider, so that a slow response does not hold up other logins.
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+func New(config Config) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config}
+}
+
+// Issuer identifies the provider, for linking its users to ours.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// Discover fetches and caches the provider's discovery document.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	cached := p.metadata
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var metadata Metadata
+	err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery: document is missing endpoints")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata == nil {
+		p.metadata = &metadata
+	}
+	return p.metadata, nil
+}
+
+// AuthRequest is what has to be remembered between sending the user to the
+// provider and the callback: State to match the callback to the request,
+// Nonce to match the ID token to it, and Verifier for PKCE.
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func NewAuthRequest() (*AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// challenge is the S256 PKCE code challenge of the verifier.
+func (a *AuthRequest) challenge() string {
+	sum := sha256.Sum256([]byte(a.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to send the user to.
+func (p *Provider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", req.State)
+	v.Set("nonce", req.Nonce)
+	v.Set("code_challenge", req.challenge())
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the validated claims
+// of the ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+	form.Set("code_verifier", req.Verifier)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	resp, err := p.config.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange: provider responded %s", resp.Status)
+	}
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("token exchange: no id_token in response")
+	}
+	return p.VerifyIDToken(ctx, body.IDToken, req.Nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken string, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.config.Issuer:
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidIDToken)
+	case !slices.Contains(claims.Audience, p.config.ClientID):
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidIDToken)
+	case now.Add(-clockSkew).Unix() >= claims.Expiry:
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case claims.Nonce == "" || claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: wrong nonce", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+// key returns the provider's signing key kid. The key set is fetched again
+// when kid is unknown, which is how providers roll their keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err = p.getJSON(ctx, metadata.JWKSURI, &set)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
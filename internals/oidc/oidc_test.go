@@ -0,0 +1,289 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIdP is a stand-in identity provider. Its authorization endpoint skips
+// the login page and redirects straight back with a code for subject.
+type testIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	subject string
+	// issuer overrides the issuer in the discovery document.
+	issuer string
+	claims map[string]any
+	// jwksGate, when set, holds JWKS responses until it is closed.
+	jwksGate chan struct{}
+	// codes maps issued codes to the authorization request they answer.
+	codes map[string]url.Values
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &testIdP{t: t, key: key, kid: "k1", subject: "idp-user-1", codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.server.URL
+		if idp.issuer != "" {
+			issuer = idp.issuer
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		if idp.jwksGate != nil {
+			<-idp.jwksGate
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": idp.kid,
+			"n": base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := rand.Text()
+		idp.codes[code] = q
+		redirect := q.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		auth, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || r.PostForm.Get("client_secret") != "secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     idp.idToken(auth.Get("nonce")),
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) idToken(nonce string) string {
+	claims := map[string]any{
+		"iss":            idp.server.URL,
+		"sub":            idp.subject,
+		"aud":            "client",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "Ada@Example.com",
+		"email_verified": true,
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	return idp.sign(claims)
+}
+
+func (idp *testIdP) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": idp.kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	require.NoError(idp.t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (idp *testIdP) provider() *Provider {
+	return New(Config{
+		Issuer:       idp.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.test/auth/oidc/callback",
+		HTTPClient:   idp.server.Client(),
+	})
+}
+
+// authorize follows the authorization URL and returns the code and state the
+// provider redirects back with.
+func (idp *testIdP) authorize(authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	require.NoError(idp.t, err)
+	resp.Body.Close()
+	require.Equal(idp.t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(idp.t, err)
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestLoginFlow(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	req, err := NewAuthRequest()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	require.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+
+	code, state := idp.authorize(authURL)
+	assert.Equal(t, req.State, state)
+
+	claims, err := provider.Exchange(ctx, code, req)
+	require.NoError(t, err)
+	assert.Equal(t, "idp-user-1", claims.Subject)
+	assert.Equal(t, "Ada@Example.com", claims.Email)
+	assert.True(t, bool(claims.EmailVerified))
+
+	_, err = provider.Exchange(ctx, code, req)
+	assert.Error(t, err, "codes are single use")
+}
+
+func TestExchangeRequiresVerifier(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	req, err := NewAuthRequest()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	require.NoError(t, err)
+	code, _ := idp.authorize(authURL)
+
+	other, err := NewAuthRequest()
+	require.NoError(t, err)
+	_, err = provider.Exchange(ctx, code, &AuthRequest{State: req.State, Nonce: req.Nonce, Verifier: other.Verifier})
+	assert.Error(t, err)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss": idp.server.URL, "sub": "s", "aud": []string{"other", "client"}, "nonce": "n",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(), "email_verified": "true",
+		}
+	}
+	claims, err := provider.VerifyIDToken(ctx, idp.sign(valid()), "n")
+	require.NoError(t, err)
+	assert.True(t, bool(claims.EmailVerified))
+
+	tests := []struct {
+		name   string
+		change func(map[string]any)
+		nonce  string
+	}{
+		{"wrong nonce", func(map[string]any) {}, "other"},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.test" }, "n"},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "other" }, "n"},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-2 * clockSkew).Unix() }, "n"},
+		{"issued in the future", func(c map[string]any) { c["iat"] = time.Now().Add(2 * clockSkew).Unix() }, "n"},
+		{"no subject", func(c map[string]any) { delete(c, "sub") }, "n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(c)
+			_, err := provider.VerifyIDToken(ctx, idp.sign(c), tt.nonce)
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp.key = other
+	_, err = provider.VerifyIDToken(ctx, idp.sign(valid()), "n")
+	assert.ErrorIs(t, err, ErrInvalidIDToken, "signed with a key that does not match the published one")
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	_, err := provider.VerifyIDToken(ctx, idp.idToken("n"), "n")
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp.key, idp.kid = key, "k2"
+	_, err = provider.VerifyIDToken(ctx, idp.idToken("n"), "n")
+	assert.NoError(t, err, "unknown kid refetches the key set")
+}
+
+func TestSlowKeyFetchDoesNotBlockLogins(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	ctx := context.Background()
+
+	_, err := provider.VerifyIDToken(ctx, idp.idToken("n"), "n")
+	require.NoError(t, err)
+
+	idp.kid = "unknown"
+	unknownKid := idp.idToken("n")
+	idp.kid = "k1"
+	idp.jwksGate = make(chan struct{})
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := provider.VerifyIDToken(ctx, unknownKid, "n")
+		fetched <- err
+	}()
+
+	verified := make(chan error, 1)
+	go func() {
+		// Give the other login time to start its key fetch.
+		time.Sleep(50 * time.Millisecond)
+		_, err := provider.VerifyIDToken(ctx, idp.idToken("n"), "n")
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Error("a cached key waited for the key fetch of another login")
+	}
+
+	close(idp.jwksGate)
+	assert.ErrorIs(t, <-fetched, ErrInvalidIDToken)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.issuer = "https://evil.test"
+	_, err := idp.provider().Discover(context.Background())
+	assert.ErrorContains(t, err, "does not match")
+}
@@ -0,0 +1,68 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// BreachedList is a set of passwords known from data breaches. A nil list
+// contains nothing.
+type BreachedList struct {
+	sums map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedList reads a file with one password per line. Lines may also be
+// uppercase SHA-1 hashes as in the Pwned Passwords downloads, optionally
+// followed by ":count".
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedList{sums: map[[sha1.Size]byte]struct{}{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		list.sums[breachedListSum(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// breachedListSum returns the SHA-1 of a line, which is either the hash
+// itself or the password to hash.
+func breachedListSum(line string) [sha1.Size]byte {
+	hash, _, _ := strings.Cut(line, ":")
+	var sum [sha1.Size]byte
+	if len(hash) == 2*sha1.Size && strings.ToUpper(hash) == hash {
+		if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+			return sum
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+func (l *BreachedList) Contains(plainText string) bool {
+	if l == nil {
+		return false
+	}
+	_, found := l.sums[sha1.Sum([]byte(plainText))]
+	return found
+}
+
+func (l *BreachedList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.sums)
+}
@@ -0,0 +1,183 @@
+// Package passwords hashes passwords. Hashes are stored in a self-describing
+// format ("$2a$12$…" for bcrypt, "$argon2id$v=19$m=…,t=…,p=…$…" for
+// argon2id), so any of them can be verified whichever hasher is configured,
+// and hashes made with an older configuration can be recognised and replaced.
+package passwords
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+type Hasher interface {
+	Hash(plainText string) ([]byte, error)
+	// NeedsRehash reports whether hash was made with another algorithm or
+	// other parameters than this hasher's.
+	NeedsRehash(hash []byte) bool
+}
+
+// Verify checks plainText against a hash made by any of the hashers.
+func Verify(hash []byte, plainText string) (bool, error) {
+	switch {
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword(hash, []byte(plainText))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case bytes.HasPrefix(hash, []byte(argon2idPrefix)):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(plainText), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(plainText string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plainText), b.Cost)
+}
+
+func (b Bcrypt) NeedsRehash(hash []byte) bool {
+	if !isBcrypt(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != b.Cost
+}
+
+func isBcrypt(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) || bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2id hashes with argon2id. Memory is in KiB.
+type Argon2id struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id follows the OWASP recommendation of 64 MiB and 3 passes.
+var DefaultArgon2id = Argon2id{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+func (a Argon2id) Hash(plainText string) ([]byte, error) {
+	salt := make([]byte, a.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(plainText), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Appendf(nil, "%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, a.Memory, a.Iterations,
+		a.Parallelism, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2id) NeedsRehash(hash []byte) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != a.Memory || params.Iterations != a.Iterations || params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength || uint32(len(key)) != a.KeyLength
+}
+
+func decodeArgon2id(hash []byte) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+	parts := bytes.Split(hash, []byte("$"))
+	// "", "argon2id", "v=19", "m=…,t=…,p=…", salt, key
+	if len(parts) != 6 || string(parts[1]) != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+	var version int
+	_, err := fmt.Sscanf(string(parts[2]), "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	_, err = fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2 key")
+	}
+	params.SaltLength, params.KeyLength = uint32(len(salt)), uint32(len(key))
+	return params, salt, key, nil
+}
+
+// FromEnv returns the hasher configured with PASSWORD_HASHER ("bcrypt", the
+// default, or "argon2id") and its parameters: PASSWORD_BCRYPT_COST, or
+// PASSWORD_ARGON2_MEMORY (KiB), PASSWORD_ARGON2_ITERATIONS and
+// PASSWORD_ARGON2_PARALLELISM.
+func FromEnv() (Hasher, error) {
+	switch name := os.Getenv("PASSWORD_HASHER"); name {
+	case "", "bcrypt":
+		cost, err := envInt("PASSWORD_BCRYPT_COST", 12)
+		if err != nil {
+			return nil, err
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return Bcrypt{Cost: cost}, nil
+	case "argon2id":
+		a := DefaultArgon2id
+		memory, err := envInt("PASSWORD_ARGON2_MEMORY", int(a.Memory))
+		if err != nil {
+			return nil, err
+		}
+		iterations, err := envInt("PASSWORD_ARGON2_ITERATIONS", int(a.Iterations))
+		if err != nil {
+			return nil, err
+		}
+		parallelism, err := envInt("PASSWORD_ARGON2_PARALLELISM", int(a.Parallelism))
+		if err != nil {
+			return nil, err
+		}
+		if memory < 8*1024 || iterations < 1 || parallelism < 1 || parallelism > 255 {
+			return nil, errors.New("argon2id needs at least 8192 KiB of memory, 1 iteration and a parallelism of 1 to 255")
+		}
+		a.Memory, a.Iterations, a.Parallelism = uint32(memory), uint32(iterations), uint8(parallelism)
+		return a, nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASHER %q", name)
+	}
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,113 @@
+package passwords
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastArgon2id keeps the tests quick; the parameters do not matter to them.
+var fastArgon2id = Argon2id{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashers(t *testing.T) {
+	for name, hasher := range map[string]Hasher{"bcrypt": Bcrypt{Cost: 4}, "argon2id": fastArgon2id} {
+		t.Run(name, func(t *testing.T) {
+			hash, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+			assert.False(t, hasher.NeedsRehash(hash))
+
+			ok, err := Verify(hash, "correct horse")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = Verify(hash, "battery staple")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			again, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, again, "salted")
+		})
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	hash, err := fastArgon2id.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=8192,t=1,p=1$"), string(hash))
+
+	// A hash from the reference implementation:
+	// echo -n password | argon2 somesalt -id -t 2 -m 16 -p 1 -l 32
+	reference := []byte("$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc")
+	ok, err := Verify(reference, "password")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = Verify([]byte("$argon2id$v=19$m=x$salt$key"), "password")
+	assert.Error(t, err)
+	_, err = Verify([]byte("plain"), "password")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: 4}.Hash("pw")
+	require.NoError(t, err)
+	argonHash, err := fastArgon2id.Hash("pw")
+	require.NoError(t, err)
+
+	assert.True(t, Bcrypt{Cost: 5}.NeedsRehash(bcryptHash), "other cost")
+	assert.True(t, Bcrypt{Cost: 4}.NeedsRehash(argonHash), "other algorithm")
+	assert.True(t, fastArgon2id.NeedsRehash(bcryptHash), "other algorithm")
+
+	stronger := fastArgon2id
+	stronger.Iterations = 2
+	assert.True(t, stronger.NeedsRehash(argonHash), "other parameters")
+}
+
+func TestFromEnv(t *testing.T) {
+	hasher, err := FromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Bcrypt{Cost: 12}, hasher)
+
+	t.Setenv("PASSWORD_HASHER", "argon2id")
+	t.Setenv("PASSWORD_ARGON2_ITERATIONS", "4")
+	hasher, err = FromEnv()
+	require.NoError(t, err)
+	expected := DefaultArgon2id
+	expected.Iterations = 4
+	assert.Equal(t, expected, hasher)
+
+	t.Setenv("PASSWORD_ARGON2_MEMORY", "1024")
+	_, err = FromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("PASSWORD_HASHER", "md5")
+	_, err = FromEnv()
+	assert.Error(t, err)
+}
+
+func TestBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// The second line is the SHA-1 of "password" with a count, as in the
+	// Pwned Passwords downloads.
+	content := "123456\r\n5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n\nqwerty\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	list, err := LoadBreachedList(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, list.Len())
+	assert.True(t, list.Contains("123456"))
+	assert.True(t, list.Contains("password"))
+	assert.True(t, list.Contains("qwerty"))
+	assert.False(t, list.Contains("Password"))
+	assert.False(t, list.Contains("correct horse battery staple"))
+
+	var none *BreachedList
+	assert.False(t, none.Contains("123456"))
+
+	_, err = LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
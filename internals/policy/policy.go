@@ -0,0 +1,53 @@
+// Package policy decides what a user may do with a resource. Handlers ask Can
+// instead of comparing user IDs themselves, so that ownership and role
+// permissions are applied the same way everywhere.
+package policy
+
+import "go_beginner/internals/store"
+
+type Action string
+
+const (
+	Read   Action = "read"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// Owned is a resource that belongs to a user. Workouts, templates, programs,
+// goals and users themselves are Owned.
+type Owned interface {
+	OwnerID() int
+}
+
+// WorkoutsOf stands for all workouts of a user, for listing them.
+type WorkoutsOf int
+
+func (w WorkoutsOf) OwnerID() int { return int(w) }
+
+// RecordsOf stands for the personal records of a user.
+type RecordsOf int
+
+func (r RecordsOf) OwnerID() int { return int(r) }
+
+// Can reports whether user may perform action on resource. Anonymous users
+// may do nothing, owners may do everything, and everyone else needs a
+// permission from their role.
+func Can(user *store.User, action Action, resource Owned) bool {
+	if user == nil || user.IsAnonymous() {
+		return false
+	}
+	if resource.OwnerID() == user.ID {
+		return true
+	}
+	switch resource.(type) {
+	case *store.Program:
+		// Programs are a shared catalog: anyone can read and enroll in
+		// them, only the author can change them.
+		return action == Read
+	case *store.Workout, WorkoutsOf, RecordsOf:
+		return action == Read && user.Permissions.Include(store.PermissionReadAnyWorkouts)
+	case *store.User:
+		return action == Read && user.Permissions.Include(store.PermissionReadUsers)
+	}
+	return false
+}
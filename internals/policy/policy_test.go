@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"testing"
+
+	"go_beginner/internals/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	owner := &store.User{ID: 1, Role: store.RoleUser}
+	other := &store.User{ID: 2, Role: store.RoleUser}
+	coach := &store.User{ID: 3, Role: store.RoleCoach, Permissions: store.Permissions{store.PermissionReadAnyWorkouts}}
+	admin := &store.User{ID: 4, Role: store.RoleAdmin, Permissions: store.Permissions{
+		store.PermissionReadUsers, store.PermissionAssignRoles, store.PermissionReadAnyWorkouts,
+	}}
+
+	workout := &store.Workout{ID: 10, UserId: owner.ID}
+	template := &store.WorkoutTemplate{ID: 11, UserID: owner.ID}
+	program := &store.Program{ID: 12, UserID: owner.ID}
+
+	tests := []struct {
+		name     string
+		user     *store.User
+		action   Action
+		resource Owned
+		want     bool
+	}{
+		{"owner reads workout", owner, Read, workout, true},
+		{"owner deletes workout", owner, Delete, workout, true},
+		{"other reads workout", other, Read, workout, false},
+		{"coach reads workout", coach, Read, workout, true},
+		{"coach updates workout", coach, Update, workout, false},
+		{"coach lists workouts", coach, Read, WorkoutsOf(owner.ID), true},
+		{"other lists workouts", other, Read, WorkoutsOf(owner.ID), false},
+		{"coach reads records", coach, Read, RecordsOf(owner.ID), true},
+		{"admin reads template", admin, Read, template, false},
+		{"other reads program", other, Read, program, true},
+		{"other deletes program", other, Delete, program, false},
+		{"user updates self", owner, Update, owner, true},
+		{"user reads other user", owner, Read, other, false},
+		{"admin reads user", admin, Read, owner, true},
+		{"admin deletes user", admin, Delete, owner, false},
+		{"anonymous reads program", store.AnonymousUser, Read, program, false},
+		{"nil user", nil, Read, program, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Can(tt.user, tt.action, tt.resource))
+		})
+	}
+}
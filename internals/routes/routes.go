@@ -2,6 +2,7 @@ package routes
 
 import (
 	"go_beginner/internals/app"
+	"go_beginner/internals/store"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -12,20 +13,93 @@ func SetipRoutes(app *app.Application) *chi.Mux {
 
 	r.Group(func (r chi.Router){
 		r.Use(app.Middleware.Authenticate)
-		r.Get("/workout/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
-		r.Post("/workout", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
-		r.Patch("/workout/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkout))
-		r.Delete("/workout/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout))
-		r.Get("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetAllWorkouts))
+		r.Post("/logout", app.Middleware.RequireUser(app.TokenHandler.HandleLogout))
+		r.Post("/logout/all", app.Middleware.RequireUser(app.TokenHandler.HandleLogoutAll))
+		r.Get("/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleGetAPIKeys))
+		r.Post("/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Delete("/me/api-keys/{id}", app.Middleware.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+		r.Get("/me/sessions", app.Middleware.RequireUser(app.TokenHandler.HandleGetSessions))
+		r.Delete("/me/sessions/{id}", app.Middleware.RequireUser(app.TokenHandler.HandleDeleteSession))
+
+		r.Get("/workout/{id}", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID)))
+		r.Post("/workout", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.WorkoutHandler.HandleCreateWorkout)))
+		r.Patch("/workout/{id}", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.WorkoutHandler.HandleUpdateWorkout)))
+		r.Delete("/workout/{id}", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsWrite, app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout)))
+		r.Get("/workouts", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.WorkoutHandler.HandleGetAllWorkouts)))
+		r.Get("/users/{id}/records", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.RecordHandler.HandleGetUserRecords)))
+		r.Post("/workout/{id}/template", app.Middleware.RequireUser(app.TemplateHandler.HandleCreateTemplateFromWorkout))
+
+		r.Get("/templates", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.TemplateHandler.HandleGetTemplates)))
+		r.Post("/templates", app.Middleware.RequireUser(app.TemplateHandler.HandleCreateTemplate))
+		r.Get("/templates/{id}", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.TemplateHandler.HandleGetTemplateByID)))
+		r.Patch("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleUpdateTemplate))
+		r.Delete("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleDeleteTemplate))
+		r.Post("/templates/{id}/start", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleStartWorkout)))
+
+		r.Get("/me/stats/summary", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.StatsHandler.HandleGetSummary)))
+		r.Get("/me/stats/volume", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.StatsHandler.HandleGetVolume)))
+		r.Get("/me/stats/exercises/{id}", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.StatsHandler.HandleGetExerciseProgress)))
+		r.Get("/me/stats/frequency", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.StatsHandler.HandleGetFrequency)))
+
+		r.Get("/me/goals", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.GoalHandler.HandleGetGoals)))
+		r.Post("/me/goals", app.Middleware.RequireUser(app.GoalHandler.HandleCreateGoal))
+		r.Get("/me/goals/{id}", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.GoalHandler.HandleGetGoalByID)))
+		r.Patch("/me/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleUpdateGoal))
+		r.Delete("/me/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleDeleteGoal))
+		r.Get("/me/streak", app.Middleware.RequireScope(store.APIKeyScopeStatsRead, app.Middleware.RequireUser(app.GoalHandler.HandleGetStreak)))
+
+		r.Get("/programs", app.Middleware.RequireUser(app.ProgramHandler.HandleGetPrograms))
+		r.Post("/programs", app.Middleware.RequireUser(app.ProgramHandler.HandleCreateProgram))
+		r.Get("/programs/{id}", app.Middleware.RequireUser(app.ProgramHandler.HandleGetProgramByID))
+		r.Delete("/programs/{id}", app.Middleware.RequireUser(app.ProgramHandler.HandleDeleteProgram))
+		r.Post("/programs/{id}/enroll", app.Middleware.RequireUser(app.ProgramHandler.HandleEnroll))
+		r.Get("/me/program", app.Middleware.RequireUser(app.ProgramHandler.HandleGetMyProgram))
+		r.Get("/me/program/today", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.ProgramHandler.HandleGetToday)))
+		r.Delete("/me/program", app.Middleware.RequireUser(app.ProgramHandler.HandleLeaveProgram))
+
+		r.Get("/exercises", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.ExerciseHandler.HandleSearchExercises)))
+		r.Get("/exercises/{id}", app.Middleware.RequireScope(store.APIKeyScopeWorkoutsRead, app.Middleware.RequireUser(app.ExerciseHandler.HandleGetExerciseByID)))
+		r.Post("/exercises", app.Middleware.RequireUser(app.ExerciseHandler.HandleCreateExercise))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(app.Middleware.Authenticate)
+
+		r.Get("/me", app.Middleware.RequireUser(app.UserHandler.HandleGetMe))
+		r.Patch("/me", app.Middleware.RequireUser(app.UserHandler.HandleUpdateMe))
+		r.Delete("/me", app.Middleware.RequireUser(app.UserHandler.HandleDeleteMe))
+		r.Get("/me/profile", app.Middleware.RequireUser(app.ProfileHandler.HandleGetProfile))
+		r.Patch("/me/profile", app.Middleware.RequireUser(app.ProfileHandler.HandleUpdateProfile))
+		r.Put("/me/password", app.Middleware.RequireUser(app.PasswordHandler.HandleChangePassword))
+		r.Get("/me/security-events", app.Middleware.RequireUser(app.AuthEventHandler.HandleGetMyEvents))
+		r.Get("/me/mfa", app.Middleware.RequireUser(app.MFAHandler.HandleGetMFA))
+		r.Post("/me/mfa", app.Middleware.RequireUser(app.MFAHandler.HandleBeginMFA))
+		r.Post("/me/mfa/confirm", app.Middleware.RequireUser(app.MFAHandler.HandleConfirmMFA))
+		r.Delete("/me/mfa", app.Middleware.RequireUser(app.MFAHandler.HandleDisableMFA))
+		r.Get("/user/{id}", app.Middleware.RequireUser(app.UserHandler.HandleGetUserByID))
+		r.Patch("/user/{id}", app.Middleware.RequireUser(app.UserHandler.HandleUpdateUser))
+		r.Delete("/user/{id}", app.Middleware.RequireUser(app.UserHandler.HandleDeleteUser))
+
+		r.Get("/admin/users", app.Middleware.RequirePermission(store.PermissionReadUsers, app.UserHandler.HandleGetUsers))
+		r.Get("/admin/users/lookup", app.Middleware.RequirePermission(store.PermissionReadUsers, app.UserHandler.HandleGetUserByEmail))
+		r.Put("/admin/users/{id}/role", app.Middleware.RequirePermission(store.PermissionAssignRoles, app.RoleHandler.HandleSetUserRole))
+		r.Get("/admin/roles", app.Middleware.RequirePermission(store.PermissionAssignRoles, app.RoleHandler.HandleListRoles))
+		r.Get("/admin/security-events", app.Middleware.RequirePermission(store.PermissionReadAuditLog, app.AuthEventHandler.HandleGetEvents))
+		r.Get("/admin/workouts/{id}", app.Middleware.RequirePermission(store.PermissionReadAnyWorkouts, app.WorkoutHandler.HandleGetWorkoutByID))
 	})
 
 	r.Post("/user", app.UserHandler.HandleCreateUser)
-	r.Get("/user/{id}", app.UserHandler.HandleGetUserByID)
-	r.Patch("/user/{id}", app.UserHandler.HandleUpdateUser)
-	r.Delete("/user/{id}", app.UserHandler.HandleDeleteUser)
-	// r.Get("/users", app.UserHandler.÷)
+	r.Put("/users/activated", app.UserHandler.HandleActivateUser)
 	
 	r.Post("/login", app.TokenHandler.HandleCreateToken)
+	r.Post("/login/mfa", app.TokenHandler.HandleLoginMFA)
+	if app.OIDCHandler != nil {
+		r.Get("/login/oidc", app.OIDCHandler.HandleBeginLogin)
+		r.Get("/login/oidc/callback", app.OIDCHandler.HandleCallback)
+	}
+	r.Post("/tokens/refresh", app.TokenHandler.HandleRefreshToken)
+	r.Post("/password-reset", app.PasswordHandler.HandleRequestPasswordReset)
+	r.Put("/password-reset", app.PasswordHandler.HandleResetPassword)
 	// r.Post("/register", app.UserHandler.HandleCreateUser)
 
 	return r 
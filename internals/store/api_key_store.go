@@ -0,0 +1,198 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so that keys are easy to recognize,
+// e.g. by secret scanners, and the middleware can tell them from tokens.
+const APIKeyPrefix = "wka_"
+
+// Scopes an API key can be limited to.
+const (
+	APIKeyScopeWorkoutsRead  = "workouts:read"
+	APIKeyScopeWorkoutsWrite = "workouts:write"
+	APIKeyScopeStatsRead     = "stats:read"
+)
+
+var APIKeyScopes = []string{APIKeyScopeWorkoutsRead, APIKeyScopeWorkoutsWrite, APIKeyScopeStatsRead}
+
+var (
+	ErrInvalidAPIKey       = errors.New("invalid API key")
+	ErrDuplicateAPIKeyName = errors.New("an API key with this name already exists")
+)
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// PlainText is only set when the key is created.
+	PlainText string `json:"key,omitempty"`
+	Hash      []byte `json:"-"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+func (k *APIKey) Validate() error {
+	k.Name = strings.TrimSpace(k.Name)
+	if k.Name == "" || len(k.Name) > 100 {
+		return fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidAPIKey)
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+	}
+	if k.Expiry != nil && !k.Expiry.After(time.Now()) {
+		return fmt.Errorf("%w: expiry must be in the future", ErrInvalidAPIKey)
+	}
+	return nil
+}
+
+// generate sets a new random key and its hash.
+func (k *APIKey) generate() error {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	k.PlainText = APIKeyPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	k.Prefix = k.PlainText[:len(APIKeyPrefix)+8]
+	k.Hash = hashAPIKey(k.PlainText)
+	return nil
+}
+
+func hashAPIKey(plainText string) []byte {
+	hash := sha256.Sum256([]byte(plainText))
+	return hash[:]
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{
+		db: db,
+	}
+}
+
+type APIKeyStore interface {
+	// CreateAPIKey generates the key, which is only returned this once.
+	CreateAPIKey(key *APIKey) (*APIKey, error)
+	ListAPIKeys(userID int) ([]APIKey, error)
+	DeleteAPIKey(userID int, id int) (bool, error)
+	// GetUserForAPIKey returns the owner of an unexpired key, nil when there
+	// is none, and records that the key was used.
+	GetUserForAPIKey(plainText string) (*User, *APIKey, error)
+}
+
+func (s *PostgresAPIKeyStore) CreateAPIKey(key *APIKey) (*APIKey, error) {
+	err := key.generate()
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+	err = s.db.QueryRow(query, key.UserID, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), key.Expiry).
+		Scan(&key.ID, &key.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateAPIKeyName
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *PostgresAPIKeyStore) ListAPIKeys(userID int) ([]APIKey, error) {
+	query := `
+	SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.Expiry, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresAPIKeyStore) DeleteAPIKey(userID int, id int) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *PostgresAPIKeyStore) GetUserForAPIKey(plainText string) (*User, *APIKey, error) {
+	query := `
+	WITH k AS (
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE hash = $1 AND (expiry IS NULL OR expiry > NOW())
+		RETURNING id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+	)
+	SELECT u.id, u.name, u.email, u.password, u.bio, u.activated, u.role, u.created_at, u.updated_at,
+		COALESCE((SELECT string_agg(rp.permission, ',') FROM role_permissions rp WHERE rp.role = u.role), ''),
+		k.id, k.name, k.prefix, k.scopes, k.expiry, k.last_used_at, k.created_at
+	FROM users u
+	INNER JOIN k ON u.id = k.user_id
+	`
+	var user User
+	var key APIKey
+	var scopes string
+	err := s.db.QueryRow(query, hashAPIKey(plainText)).Scan(
+		&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.Activated, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt, &user.Permissions,
+		&key.ID, &key.Name, &key.Prefix, &scopes, &key.Expiry, &key.LastUsedAt, &key.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key.UserID = user.ID
+	key.Scopes = strings.Fields(scopes)
+	return &user, &key, nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyValidate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	valid := &APIKey{Name: " dashboard ", Scopes: []string{APIKeyScopeWorkoutsRead, APIKeyScopeStatsRead}, Expiry: &future}
+	require.NoError(t, valid.Validate())
+	assert.Equal(t, "dashboard", valid.Name)
+	assert.True(t, valid.HasScope(APIKeyScopeStatsRead))
+	assert.False(t, valid.HasScope(APIKeyScopeWorkoutsWrite))
+
+	for name, key := range map[string]*APIKey{
+		"no name":       {Scopes: []string{APIKeyScopeWorkoutsRead}},
+		"no scopes":     {Name: "script"},
+		"unknown scope": {Name: "script", Scopes: []string{"users:read"}},
+		"expired":       {Name: "script", Scopes: []string{APIKeyScopeWorkoutsRead}, Expiry: &past},
+	} {
+		assert.ErrorIs(t, key.Validate(), ErrInvalidAPIKey, name)
+	}
+}
+
+func TestAPIKeyGenerate(t *testing.T) {
+	var a, b APIKey
+	require.NoError(t, a.generate())
+	require.NoError(t, b.generate())
+
+	assert.True(t, strings.HasPrefix(a.PlainText, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(a.PlainText, a.Prefix))
+	assert.Len(t, a.Prefix, len(APIKeyPrefix)+8)
+	assert.Equal(t, hashAPIKey(a.PlainText), a.Hash)
+	assert.NotEqual(t, a.PlainText, b.PlainText)
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Types of AuthEvent.
+const (
+	AuthEventLoginSucceeded  = "login_succeeded"
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventTokenRefreshed  = "token_refreshed"
+	AuthEventTokenRevoked    = "token_revoked"
+	AuthEventPasswordChanged = "password_changed"
+	AuthEventPasswordReset   = "password_reset"
+	AuthEventAccountDeleted  = "account_deleted"
+)
+
+// AuthEvent is an entry of the security audit log. UserID is nil when the
+// event concerns no known account, like a login with an unknown email.
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	UserID    *int      `json:"user_id"`
+	Email     string    `json:"email,omitempty"`
+	Type      string    `json:"type"`
+	Detail    string    `json:"detail,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthEventFilter narrows ListAuthEvents. Zero values match everything.
+type AuthEventFilter struct {
+	UserID *int
+	Email  string
+	Type   string
+	IP     string
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int
+	Offset int
+}
+
+type PostgresAuthEventStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAuthEventStore(db *sql.DB) *PostgresAuthEventStore {
+	return &PostgresAuthEventStore{
+		db: db,
+	}
+}
+
+type AuthEventStore interface {
+	RecordAuthEvent(event *AuthEvent) error
+	// ListAuthEvents returns the newest events first.
+	ListAuthEvents(filter AuthEventFilter) ([]AuthEvent, error)
+}
+
+func (s *PostgresAuthEventStore) RecordAuthEvent(event *AuthEvent) error {
+	query := `
+	INSERT INTO auth_events (user_id, email, type, detail, ip, user_agent)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+	return s.db.QueryRow(query, event.UserID, event.Email, event.Type, event.Detail, event.IP, event.UserAgent).
+		Scan(&event.ID, &event.CreatedAt)
+}
+
+func (s *PostgresAuthEventStore) ListAuthEvents(filter AuthEventFilter) ([]AuthEvent, error) {
+	query := `
+	SELECT id, user_id, email, type, detail, ip, user_agent, created_at
+	FROM auth_events
+	WHERE ($1::bigint IS NULL OR user_id = $1)
+	AND ($2 = '' OR LOWER(email) = LOWER($2))
+	AND ($3 = '' OR type = $3)
+	AND ($4 = '' OR ip = $4)
+	AND ($5::timestamptz IS NULL OR created_at >= $5)
+	AND ($6::timestamptz IS NULL OR created_at < $6)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $7 OFFSET $8
+	`
+	rows, err := s.db.Query(query, filter.UserID, filter.Email, filter.Type, filter.IP, filter.Since, filter.Until,
+		filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuthEvent{}
+	for rows.Next() {
+		var event AuthEvent
+		err := rows.Scan(&event.ID, &event.UserID, &event.Email, &event.Type, &event.Detail, &event.IP,
+			&event.UserAgent, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresAuthEventStore(db)
+	userID := createTestUser(t, db, "audit-owner")
+	otherID := createTestUser(t, db, "audit-other")
+
+	events := []AuthEvent{
+		{UserID: &userID, Email: "audit-owner@example.com", Type: AuthEventLoginFailed, IP: "192.0.2.1"},
+		{UserID: &userID, Email: "audit-owner@example.com", Type: AuthEventLoginSucceeded, IP: "192.0.2.1"},
+		{UserID: &userID, Type: AuthEventPasswordChanged, IP: "192.0.2.2"},
+		{UserID: &otherID, Email: "audit-other@example.com", Type: AuthEventLoginSucceeded, IP: "192.0.2.3"},
+	}
+	for i := range events {
+		require.NoError(t, store.RecordAuthEvent(&events[i]))
+		assert.NotZero(t, events[i].ID)
+	}
+
+	t.Run("filters by user and type, newest first", func(t *testing.T) {
+		mine, err := store.ListAuthEvents(AuthEventFilter{UserID: &userID, Limit: 50})
+		require.NoError(t, err)
+		require.Len(t, mine, 3)
+		assert.Equal(t, AuthEventPasswordChanged, mine[0].Type)
+		assert.Equal(t, AuthEventLoginFailed, mine[2].Type)
+
+		logins, err := store.ListAuthEvents(AuthEventFilter{UserID: &userID, Type: AuthEventLoginSucceeded, Limit: 50})
+		require.NoError(t, err)
+		require.Len(t, logins, 1)
+		assert.Equal(t, events[1].ID, logins[0].ID)
+	})
+
+	t.Run("filters by time", func(t *testing.T) {
+		since := events[0].CreatedAt.Add(-time.Second)
+		until := events[3].CreatedAt.Add(time.Second)
+		all, err := store.ListAuthEvents(AuthEventFilter{UserID: &userID, Since: &since, Until: &until, Limit: 50})
+		require.NoError(t, err)
+		assert.Len(t, all, 3)
+
+		later := events[3].CreatedAt.Add(time.Second)
+		none, err := store.ListAuthEvents(AuthEventFilter{UserID: &userID, Since: &later, Limit: 50})
+		require.NoError(t, err)
+		assert.Empty(t, none)
+
+		none, err = store.ListAuthEvents(AuthEventFilter{UserID: &userID, Until: &since, Limit: 50})
+		require.NoError(t, err)
+		assert.Empty(t, none)
+	})
+
+	t.Run("is append-only", func(t *testing.T) {
+		_, err := db.Exec(`UPDATE auth_events SET type = $1 WHERE id = $2`, AuthEventLoginSucceeded, events[0].ID)
+		assert.ErrorContains(t, err, "append-only")
+		_, err = db.Exec(`DELETE FROM auth_events WHERE id = $1`, events[0].ID)
+		assert.ErrorContains(t, err, "append-only")
+
+		kept, err := store.ListAuthEvents(AuthEventFilter{UserID: &userID, Type: AuthEventLoginFailed, Limit: 50})
+		require.NoError(t, err)
+		assert.Len(t, kept, 1)
+	})
+
+	t.Run("outlives the account", func(t *testing.T) {
+		require.NoError(t, NewPostgresUserStore(db).DeleteUser(userID))
+		kept, err := store.ListAuthEvents(AuthEventFilter{UserID: &userID, Limit: 50})
+		require.NoError(t, err)
+		assert.Len(t, kept, 3)
+	})
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Date is a calendar day without a time of day, read and written as
+// "YYYY-MM-DD" in JSON and mapped to Postgres DATE columns.
+type Date struct {
+	time.Time
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// DateIn returns the calendar day of t in loc.
+func DateIn(t time.Time, loc *time.Location) Date {
+	local := t.In(loc)
+	return NewDate(local.Year(), local.Month(), local.Day())
+}
+
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q: must be YYYY-MM-DD", s)
+	}
+	return Date{t}, nil
+}
+
+func (d Date) String() string {
+	return d.Format(time.DateOnly)
+}
+
+func (d Date) AddDays(n int) Date {
+	return Date{d.Time.AddDate(0, 0, n)}
+}
+
+// DaysSince returns the number of calendar days from other to d.
+func (d Date) DaysSince(other Date) int {
+	return int(d.Time.Sub(other.Time).Round(24*time.Hour) / (24 * time.Hour))
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid date: must be a YYYY-MM-DD string")
+	}
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d *Date) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = NewDate(v.Year(), v.Month(), v.Day())
+	case string:
+		parsed, err := ParseDate(v)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	default:
+		return fmt.Errorf("cannot scan %T into a date", src)
+	}
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
@@ -0,0 +1,326 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	MuscleGroups = []string{
+		"chest", "shoulders", "front_delts", "rear_delts", "biceps", "triceps", "forearms",
+		"lats", "upper_back", "lower_back", "abs", "quads", "hamstrings", "glutes", "calves", "cardio",
+	}
+	Equipment        = []string{"barbell", "dumbbell", "kettlebell", "machine", "cable", "band", "bodyweight", "none", "other"}
+	MovementPatterns = []string{
+		"horizontal_push", "vertical_push", "horizontal_pull", "vertical_pull", "squat", "hinge",
+		"lunge", "carry", "core", "isolation", "cardio", "other",
+	}
+)
+
+var (
+	ErrInvalidExercise = errors.New("invalid exercise")
+	ErrExerciseExists  = errors.New("an exercise with this name already exists")
+)
+
+type Exercise struct {
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	Aliases          []string  `json:"aliases"`
+	PrimaryMuscles   []string  `json:"primary_muscles"`
+	SecondaryMuscles []string  `json:"secondary_muscles"`
+	Equipment        string    `json:"equipment"`
+	MovementPattern  string    `json:"movement_pattern"`
+	UserID           *int      `json:"user_id"` // nil for the built-in library
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (e *Exercise) Validate() error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidExercise)
+	}
+	if len(e.Name) > 255 {
+		return fmt.Errorf("%w: name must be at most 255 characters", ErrInvalidExercise)
+	}
+	if len(e.PrimaryMuscles) == 0 {
+		return fmt.Errorf("%w: at least one primary muscle group is required", ErrInvalidExercise)
+	}
+	for _, muscle := range append(slices.Clone(e.PrimaryMuscles), e.SecondaryMuscles...) {
+		if !slices.Contains(MuscleGroups, muscle) {
+			return fmt.Errorf("%w: unknown muscle group %q", ErrInvalidExercise, muscle)
+		}
+	}
+	if e.Equipment != "" && !slices.Contains(Equipment, e.Equipment) {
+		return fmt.Errorf("%w: unknown equipment %q", ErrInvalidExercise, e.Equipment)
+	}
+	if e.MovementPattern != "" && !slices.Contains(MovementPatterns, e.MovementPattern) {
+		return fmt.Errorf("%w: unknown movement pattern %q", ErrInvalidExercise, e.MovementPattern)
+	}
+	for i, alias := range e.Aliases {
+		e.Aliases[i] = strings.TrimSpace(alias)
+		if e.Aliases[i] == "" {
+			return fmt.Errorf("%w: aliases cannot be blank", ErrInvalidExercise)
+		}
+	}
+	return nil
+}
+
+// ExerciseFilter narrows down SearchExercises. The built-in library and the
+// custom exercises of UserID are searched.
+type ExerciseFilter struct {
+	UserID          int
+	Search          string // matched against the name and the aliases
+	Muscle          string // primary or secondary muscle group
+	Equipment       string
+	MovementPattern string
+	Limit           int
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{
+		db: db,
+	}
+}
+
+type ExerciseStore interface {
+	SearchExercises(filter ExerciseFilter) ([]Exercise, error)
+	GetExerciseByID(id int, userID int) (*Exercise, error)
+	CreateExercise(*Exercise) (*Exercise, error)
+	ResolveExercise(name string, userID int) (*Exercise, error)
+}
+
+const exerciseColumns = `e.id, e.name, to_json(e.primary_muscles), to_json(e.secondary_muscles),
+	e.equipment, e.movement_pattern, e.user_id, e.created_at,
+	COALESCE((SELECT json_agg(a.alias ORDER BY a.alias) FROM exercise_aliases a WHERE a.exercise_id = e.id), '[]')`
+
+func scanExercise(row rowScanner, exercise *Exercise) error {
+	var primary, secondary, aliases jsonStrings
+	err := row.Scan(
+		&exercise.ID,
+		&exercise.Name,
+		&primary,
+		&secondary,
+		&exercise.Equipment,
+		&exercise.MovementPattern,
+		&exercise.UserID,
+		&exercise.CreatedAt,
+		&aliases)
+	if err != nil {
+		return err
+	}
+	exercise.PrimaryMuscles, exercise.SecondaryMuscles, exercise.Aliases = primary, secondary, aliases
+	return nil
+}
+
+func (pg *PostgresExerciseStore) SearchExercises(filter ExerciseFilter) ([]Exercise, error) {
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 50
+	}
+	conditions := []string{"(e.user_id IS NULL OR e.user_id = $1)"}
+	args := []any{filter.UserID}
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Search != "" {
+		where(`(e.name ILIKE $%[1]d OR EXISTS (
+			SELECT 1 FROM exercise_aliases a WHERE a.exercise_id = e.id AND a.alias ILIKE $%[1]d))`,
+			"%"+escapeLike(strings.TrimSpace(filter.Search))+"%")
+	}
+	if filter.Muscle != "" {
+		where("($%[1]d = ANY(e.primary_muscles) OR $%[1]d = ANY(e.secondary_muscles))", filter.Muscle)
+	}
+	if filter.Equipment != "" {
+		where("e.equipment = $%d", filter.Equipment)
+	}
+	if filter.MovementPattern != "" {
+		where("e.movement_pattern = $%d", filter.MovementPattern)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM exercises e
+		WHERE %s
+		ORDER BY e.name, e.id
+		LIMIT %d
+	`, exerciseColumns, strings.Join(conditions, " AND "), filter.Limit)
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exercises: %w", err)
+	}
+	defer rows.Close()
+
+	exercises := []Exercise{}
+	for rows.Next() {
+		exercise := Exercise{}
+		if err := scanExercise(rows, &exercise); err != nil {
+			return nil, fmt.Errorf("failed to scan exercise: %w", err)
+		}
+		exercises = append(exercises, exercise)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over exercises: %w", err)
+	}
+	return exercises, nil
+}
+
+// GetExerciseByID returns nil when the exercise doesn't exist or is another
+// user's custom exercise.
+func (pg *PostgresExerciseStore) GetExerciseByID(id int, userID int) (*Exercise, error) {
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercises e
+		WHERE e.id = $1 AND (e.user_id IS NULL OR e.user_id = $2)
+	`
+	exercise := &Exercise{}
+	err := scanExercise(pg.db.QueryRow(query, id, userID), exercise)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+func (pg *PostgresExerciseStore) CreateExercise(exercise *Exercise) (*Exercise, error) {
+	if err := exercise.Validate(); err != nil {
+		return nil, err
+	}
+	if exercise.SecondaryMuscles == nil {
+		exercise.SecondaryMuscles = []string{}
+	}
+	if exercise.Aliases == nil {
+		exercise.Aliases = []string{}
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO exercises (name, primary_muscles, secondary_muscles, equipment, movement_pattern, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(query, exercise.Name, exercise.PrimaryMuscles, exercise.SecondaryMuscles,
+		exercise.Equipment, exercise.MovementPattern, exercise.UserID).Scan(&exercise.ID, &exercise.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrExerciseExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alias := range exercise.Aliases {
+		_, err = tx.Exec(`INSERT INTO exercise_aliases (exercise_id, alias) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, exercise.ID, alias)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+// ResolveExercise maps free text such as "bb bench" to a catalog exercise
+// through the canonical names and the aliases. The user's own custom
+// exercises win over the built-in library. It returns nil when nothing
+// matches.
+func (pg *PostgresExerciseStore) ResolveExercise(name string, userID int) (*Exercise, error) {
+	id, err := resolveExerciseID(pg.db, name, userID)
+	if err != nil || id == nil {
+		return nil, err
+	}
+	return pg.GetExerciseByID(*id, userID)
+}
+
+// linkExercise checks an explicit exercise id against the catalog, filling in
+// the canonical name when none was given, or resolves the free-text name when
+// there is no id. Unknown ids are reported as ErrInvalidWorkout.
+func linkExercise(q queryRower, id *int, name string, userID int) (*int, string, error) {
+	if id == nil {
+		resolved, err := resolveExerciseID(q, name, userID)
+		return resolved, name, err
+	}
+
+	var canonical string
+	err := q.QueryRow(`SELECT name FROM exercises WHERE id = $1 AND (user_id IS NULL OR user_id = $2)`,
+		*id, userID).Scan(&canonical)
+	if err == sql.ErrNoRows {
+		return nil, name, fmt.Errorf("%w: unknown exercise_id %d", ErrInvalidWorkout, *id)
+	}
+	if err != nil {
+		return nil, name, err
+	}
+	if strings.TrimSpace(name) == "" {
+		name = canonical
+	}
+	return id, name, nil
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func resolveExerciseID(q queryRower, name string, userID int) (*int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	query := `
+		SELECT e.id
+		FROM exercises e
+		WHERE (e.user_id IS NULL OR e.user_id = $2)
+		  AND (
+			LOWER(e.name) = LOWER($1)
+			OR EXISTS (SELECT 1 FROM exercise_aliases a WHERE a.exercise_id = e.id AND LOWER(a.alias) = LOWER($1))
+		  )
+		ORDER BY e.user_id IS NULL, LOWER(e.name) = LOWER($1) DESC, e.id
+		LIMIT 1
+	`
+	var id int
+	err := q.QueryRow(query, name, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// jsonStrings scans a JSON array of strings, used for TEXT[] columns
+// selected through to_json.
+type jsonStrings []string
+
+func (j *jsonStrings) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*j = []string{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+	return json.Unmarshal(data, (*[]string)(j))
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveExercise(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	exercises := NewPostgresExerciseStore(db)
+	workouts := NewPostgresWorkoutStore(db)
+	userID := createTestUser(t, db, "exercise-owner")
+
+	bench, err := exercises.ResolveExercise("Barbell Bench Press", userID)
+	require.NoError(t, err)
+	require.NotNil(t, bench)
+
+	for _, name := range []string{"Bench", "bench press", " BB Bench Press "} {
+		resolved, err := exercises.ResolveExercise(name, userID)
+		require.NoError(t, err)
+		require.NotNil(t, resolved, name)
+		assert.Equal(t, bench.ID, resolved.ID, name)
+	}
+
+	custom, err := exercises.CreateExercise(&Exercise{
+		Name:           "Spoto Press",
+		Aliases:        []string{"Bench"},
+		PrimaryMuscles: []string{"chest"},
+		Equipment:      "barbell",
+		UserID:         &userID,
+	})
+	require.NoError(t, err)
+	resolved, err := exercises.ResolveExercise("bench", userID)
+	require.NoError(t, err)
+	assert.Equal(t, custom.ID, resolved.ID, "custom exercises win over the library")
+
+	_, err = exercises.CreateExercise(&Exercise{Name: "spoto press", PrimaryMuscles: []string{"chest"}, UserID: &userID})
+	assert.ErrorIs(t, err, ErrExerciseExists)
+
+	workout, err := workouts.CreateWorkout(&Workout{
+		Title:  "Push",
+		UserId: userID,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "OHP", Sets: 3, Reps: IntPtr(5)},
+			{ExerciseName: "Something new", Sets: 1, Reps: IntPtr(10)},
+			{ExerciseID: &bench.ID, Sets: 1, Reps: IntPtr(1)},
+		},
+	})
+	require.NoError(t, err)
+	retrieved, err := workouts.GetWorkoutByID(workout.ID)
+	require.NoError(t, err)
+	require.Len(t, retrieved.Entries, 3)
+	assert.NotNil(t, retrieved.Entries[0].ExerciseID)
+	assert.Nil(t, retrieved.Entries[1].ExerciseID)
+	assert.Equal(t, "Barbell Bench Press", retrieved.Entries[2].ExerciseName)
+}
@@ -0,0 +1,434 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidGoal = errors.New("invalid goal")
+
+const (
+	GoalMetricWorkouts = "workouts"
+	GoalMetricCalories = "calories"
+	GoalMetricDuration = "duration_minutes"
+	GoalMetricDistance = "distance" // meters, optionally of one exercise
+	GoalMetricLift     = "lift"     // heaviest set of one exercise, in kg
+)
+
+var GoalMetrics = []string{GoalMetricWorkouts, GoalMetricCalories, GoalMetricDuration, GoalMetricDistance, GoalMetricLift}
+
+const (
+	GoalCompleted = "completed"
+	GoalOnTrack   = "on_track"
+	GoalBehind    = "behind"
+	GoalMissed    = "missed"
+)
+
+// Goal is a target for one metric. Recurring goals ("4 workouts per week")
+// have a period and start over every week or month; one-off goals ("bench
+// 100kg by June") run from the start date to the optional deadline.
+type Goal struct {
+	ID         int           `json:"id"`
+	UserID     int           `json:"user_id"`
+	Title      string        `json:"title"`
+	Metric     string        `json:"metric"`
+	Target     float64       `json:"target"`
+	Period     string        `json:"period,omitempty"` // week, month or empty for a one-off goal
+	ExerciseID *int          `json:"exercise_id"`
+	StartDate  Date          `json:"start_date"`
+	Deadline   Date          `json:"deadline"`
+	Timezone   string        `json:"timezone"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	Progress   *GoalProgress `json:"progress,omitempty"`
+}
+
+func (g *Goal) OwnerID() int { return g.UserID }
+
+func (g *Goal) Validate() error {
+	g.Title = strings.TrimSpace(g.Title)
+	if g.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidGoal)
+	}
+	if !slices.Contains(GoalMetrics, g.Metric) {
+		return fmt.Errorf("%w: metric must be one of %s", ErrInvalidGoal, strings.Join(GoalMetrics, ", "))
+	}
+	if g.Target <= 0 {
+		return fmt.Errorf("%w: target must be positive", ErrInvalidGoal)
+	}
+	if g.Period != "" && g.Period != "week" && g.Period != "month" {
+		return fmt.Errorf("%w: period must be week, month or empty", ErrInvalidGoal)
+	}
+	if g.Metric == GoalMetricLift {
+		if g.ExerciseID == nil {
+			return fmt.Errorf("%w: a lift goal needs an exercise_id", ErrInvalidGoal)
+		}
+		if g.Period != "" {
+			return fmt.Errorf("%w: a lift goal cannot have a period", ErrInvalidGoal)
+		}
+	}
+	if g.Timezone == "" {
+		g.Timezone = "UTC"
+	}
+	if _, err := LoadTimezone(g.Timezone); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGoal, err)
+	}
+	if g.StartDate.IsZero() {
+		return fmt.Errorf("%w: start_date is required", ErrInvalidGoal)
+	}
+	if !g.Deadline.IsZero() && g.Deadline.Before(g.StartDate.Time) {
+		return fmt.Errorf("%w: deadline is before start_date", ErrInvalidGoal)
+	}
+	return nil
+}
+
+// Window returns the days counted towards the goal on the given day. Weekly
+// goals start over on weekStart, Monday when empty. The end is zero for a
+// one-off goal without deadline.
+//
+// The period of a recurring goal is cut to its start date and deadline.
+// Before the start date it is the first period, after the deadline the last.
+func (g *Goal) Window(today Date, weekStart string) (Date, Date) {
+	if g.Period == "" {
+		return g.StartDate, g.Deadline
+	}
+	if today.Before(g.StartDate.Time) {
+		today = g.StartDate
+	}
+	if !g.Deadline.IsZero() && today.After(g.Deadline.Time) {
+		today = g.Deadline
+	}
+	var start, end Date
+	if g.Period == "week" {
+		start = today.AddDays(-((int(today.Weekday()) + 6 - daysAfterMonday(weekStart)) % 7))
+		end = start.AddDays(6)
+	} else {
+		start = NewDate(today.Year(), today.Month(), 1)
+		end = Date{start.AddDate(0, 1, -1)}
+	}
+	if start.Before(g.StartDate.Time) {
+		start = g.StartDate
+	}
+	if !g.Deadline.IsZero() && end.After(g.Deadline.Time) {
+		end = g.Deadline
+	}
+	return start, end
+}
+
+// GoalContribution is what one workout adds to a goal.
+type GoalContribution struct {
+	PerformedAt time.Time
+	Value       float64
+}
+
+type GoalProgress struct {
+	WindowStart Date       `json:"window_start"`
+	WindowEnd   Date       `json:"window_end"`
+	Current     float64    `json:"current"`
+	Target      float64    `json:"target"`
+	Percent     float64    `json:"percent"`
+	Status      string     `json:"status"` // completed, on_track, behind or missed
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// Evaluate computes the progress of the goal on the given day from the
+// contributions of the workouts in its window. Lift goals take the heaviest
+// contribution, every other metric adds them up. A goal is on track as long
+// as the current value keeps pace with the days that have fully passed, and
+// has no progress before its window starts.
+func (g *Goal) Evaluate(contributions []GoalContribution, today Date, weekStart string) GoalProgress {
+	start, end := g.Window(today, weekStart)
+	progress := GoalProgress{WindowStart: start, WindowEnd: end, Target: g.Target}
+	if today.Before(start.Time) {
+		progress.Status = GoalOnTrack
+		return progress
+	}
+
+	contributions = slices.Clone(contributions)
+	slices.SortStableFunc(contributions, func(a, b GoalContribution) int {
+		return a.PerformedAt.Compare(b.PerformedAt)
+	})
+	for _, contribution := range contributions {
+		if g.Metric == GoalMetricLift {
+			progress.Current = max(progress.Current, contribution.Value)
+		} else {
+			progress.Current += contribution.Value
+		}
+		if progress.CompletedAt == nil && progress.Current >= g.Target {
+			completedAt := contribution.PerformedAt
+			progress.CompletedAt = &completedAt
+		}
+	}
+	progress.Current = math.Round(progress.Current*100) / 100
+	progress.Percent = math.Min(100, math.Round(progress.Current/g.Target*1000)/10)
+
+	switch {
+	case progress.CompletedAt != nil:
+		progress.Status = GoalCompleted
+	case !end.IsZero() && today.After(end.Time):
+		progress.Status = GoalMissed
+	case end.IsZero() || g.Metric == GoalMetricLift:
+		progress.Status = GoalOnTrack
+	default:
+		elapsed := float64(today.DaysSince(start))
+		total := float64(end.DaysSince(start) + 1)
+		if progress.Current < g.Target*elapsed/total {
+			progress.Status = GoalBehind
+		} else {
+			progress.Status = GoalOnTrack
+		}
+	}
+	return progress
+}
+
+type Streak struct {
+	Current     int  `json:"current"` // days, allowed rest days included
+	Longest     int  `json:"longest"`
+	LastWorkout Date `json:"last_workout"`
+	RestDays    int  `json:"rest_days"`
+}
+
+// ComputeStreak finds the current and longest runs of workout days in which
+// no more than restDays days in a row were skipped. days must be sorted and
+// unique. The current streak is still alive today while the days skipped
+// since the last workout are within the allowance.
+func ComputeStreak(days []Date, today Date, restDays int) Streak {
+	streak := Streak{RestDays: restDays}
+	var runStart, last Date
+	for _, day := range days {
+		if day.After(today.Time) {
+			break
+		}
+		if last.IsZero() || day.DaysSince(last)-1 > restDays {
+			runStart = day
+		}
+		last = day
+		streak.Longest = max(streak.Longest, last.DaysSince(runStart)+1)
+	}
+	if last.IsZero() {
+		return streak
+	}
+	streak.LastWorkout = last
+	if today.DaysSince(last)-1 <= restDays {
+		streak.Current = last.DaysSince(runStart) + 1
+	}
+	return streak
+}
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{
+		db: db,
+	}
+}
+
+type GoalStore interface {
+	CreateGoal(*Goal) (*Goal, error)
+	GetGoalByID(id int) (*Goal, error)
+	ListGoals(userID int) ([]Goal, error)
+	UpdateGoal(*Goal) error
+	DeleteGoal(id int) error
+	GetGoalContributions(goal *Goal, from Date, to Date) ([]GoalContribution, error)
+	GetWorkoutDays(userID int) ([]Date, error)
+}
+
+const goalColumns = `id, user_id, title, metric, target, COALESCE(period, ''), exercise_id, start_date, deadline,
+	timezone, created_at, updated_at`
+
+func scanGoal(row rowScanner, goal *Goal) error {
+	return row.Scan(
+		&goal.ID,
+		&goal.UserID,
+		&goal.Title,
+		&goal.Metric,
+		&goal.Target,
+		&goal.Period,
+		&goal.ExerciseID,
+		&goal.StartDate,
+		&goal.Deadline,
+		&goal.Timezone,
+		&goal.CreatedAt,
+		&goal.UpdatedAt)
+}
+
+func (pg *PostgresGoalStore) CreateGoal(goal *Goal) (*Goal, error) {
+	if err := goal.Validate(); err != nil {
+		return nil, err
+	}
+	query := `
+		INSERT INTO goals (user_id, title, metric, target, period, exercise_id, start_date, deadline, timezone)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at
+	`
+	err := pg.db.QueryRow(query, goal.UserID, goal.Title, goal.Metric, goal.Target, goal.Period, goal.ExerciseID,
+		goal.StartDate, goal.Deadline, goal.Timezone).Scan(&goal.ID, &goal.CreatedAt, &goal.UpdatedAt)
+	if isForeignKeyViolation(err) {
+		return nil, fmt.Errorf("%w: unknown exercise_id %d", ErrInvalidGoal, *goal.ExerciseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (pg *PostgresGoalStore) GetGoalByID(id int) (*Goal, error) {
+	goal := &Goal{}
+	err := scanGoal(pg.db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = $1`, id), goal)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (pg *PostgresGoalStore) ListGoals(userID int) ([]Goal, error) {
+	rows, err := pg.db.Query(`SELECT `+goalColumns+` FROM goals WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query goals: %w", err)
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		goal := Goal{}
+		if err = scanGoal(rows, &goal); err != nil {
+			return nil, fmt.Errorf("failed to scan goal: %w", err)
+		}
+		goals = append(goals, goal)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over goals: %w", err)
+	}
+	return goals, nil
+}
+
+func (pg *PostgresGoalStore) UpdateGoal(goal *Goal) error {
+	if err := goal.Validate(); err != nil {
+		return err
+	}
+	query := `
+		UPDATE goals
+		SET title = $1, metric = $2, target = $3, period = NULLIF($4, ''), exercise_id = $5, start_date = $6,
+		deadline = $7, timezone = $8, updated_at = NOW()
+		WHERE id = $9
+		RETURNING updated_at
+	`
+	err := pg.db.QueryRow(query, goal.Title, goal.Metric, goal.Target, goal.Period, goal.ExerciseID,
+		goal.StartDate, goal.Deadline, goal.Timezone, goal.ID).Scan(&goal.UpdatedAt)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: unknown exercise_id %d", ErrInvalidGoal, *goal.ExerciseID)
+	}
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("goal with ID %d not found", goal.ID)
+	}
+	return err
+}
+
+func (pg *PostgresGoalStore) DeleteGoal(id int) error {
+	res, err := pg.db.Exec(`DELETE FROM goals WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("goal with ID %d not found", id)
+	}
+	return nil
+}
+
+// goalContributionQueries select one row per workout with what it adds to a
+// goal of the metric. $1 is the user, $2 and $3 the window and $4 the
+// exercise of distance and lift goals.
+var goalContributionQueries = map[string]string{
+	GoalMetricWorkouts: `SELECT w.performed_at, 1 FROM workouts w WHERE %s`,
+	GoalMetricCalories: `SELECT w.performed_at, w.calories_burned FROM workouts w WHERE %s`,
+	GoalMetricDuration: `SELECT w.performed_at, w.duration_minutes FROM workouts w WHERE %s`,
+	GoalMetricDistance: `
+		SELECT w.performed_at, SUM(s.distance_meters)
+		FROM workouts w
+		JOIN workout_entries e ON e.workout_id = w.id
+		JOIN workout_entry_sets s ON s.entry_id = e.id
+		WHERE %s AND s.distance_meters IS NOT NULL AND ($4::bigint IS NULL OR e.exercise_id = $4)
+		GROUP BY w.id`,
+	GoalMetricLift: `
+		SELECT w.performed_at, MAX(s.weight)
+		FROM workouts w
+		JOIN workout_entries e ON e.workout_id = w.id
+		JOIN workout_entry_sets s ON s.entry_id = e.id
+		WHERE %s AND s.weight IS NOT NULL AND s.set_type <> 'warmup' AND e.exercise_id = $4
+		GROUP BY w.id`,
+}
+
+func (pg *PostgresGoalStore) GetGoalContributions(goal *Goal, from Date, to Date) ([]GoalContribution, error) {
+	query, ok := goalContributionQueries[goal.Metric]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown metric %q", ErrInvalidGoal, goal.Metric)
+	}
+	scope := `w.user_id = $1 AND ` + workoutLocalDate + ` >= $2::date
+		AND ($3::date IS NULL OR ` + workoutLocalDate + ` <= $3::date)`
+	args := []any{goal.UserID, from, to}
+	if goal.Metric == GoalMetricDistance || goal.Metric == GoalMetricLift {
+		args = append(args, goal.ExerciseID)
+	}
+
+	rows, err := pg.db.Query(fmt.Sprintf(query, scope), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query goal contributions: %w", err)
+	}
+	defer rows.Close()
+
+	contributions := []GoalContribution{}
+	for rows.Next() {
+		contribution := GoalContribution{}
+		if err = rows.Scan(&contribution.PerformedAt, &contribution.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan goal contribution: %w", err)
+		}
+		contributions = append(contributions, contribution)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over goal contributions: %w", err)
+	}
+	return contributions, nil
+}
+
+// GetWorkoutDays returns the distinct days the user worked out on, each in
+// the workout's own timezone.
+func (pg *PostgresGoalStore) GetWorkoutDays(userID int) ([]Date, error) {
+	query := `
+		SELECT DISTINCT ` + workoutLocalDate + ` AS day
+		FROM workouts w
+		WHERE w.user_id = $1
+		ORDER BY day
+	`
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workout days: %w", err)
+	}
+	defer rows.Close()
+
+	days := []Date{}
+	for rows.Next() {
+		var day Date
+		if err = rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("failed to scan workout day: %w", err)
+		}
+		days = append(days, day)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over workout days: %w", err)
+	}
+	return days, nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoalEvaluate(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2025, 3, day, 18, 0, 0, 0, time.UTC) }
+
+	t.Run("weekly workouts", func(t *testing.T) {
+		goal := &Goal{Title: "4 per week", Metric: GoalMetricWorkouts, Target: 4, Period: "week", StartDate: NewDate(2025, 1, 1)}
+		require.NoError(t, goal.Validate())
+
+		// Thursday 6th, the week started on Monday 3rd: 3 of 7 days have passed.
+		today := NewDate(2025, 3, 6)
+		start, end := goal.Window(today, "")
+		assert.Equal(t, "2025-03-03", start.String())
+		assert.Equal(t, "2025-03-09", end.String())
+
+		progress := goal.Evaluate([]GoalContribution{{at(3), 1}}, today, "")
+		assert.Equal(t, 25.0, progress.Percent)
+		assert.Equal(t, GoalBehind, progress.Status)
+
+		progress = goal.Evaluate([]GoalContribution{{at(3), 1}, {at(4), 1}}, today, "")
+		assert.Equal(t, GoalOnTrack, progress.Status)
+
+		progress = goal.Evaluate([]GoalContribution{{at(6), 1}, {at(3), 1}, {at(4), 1}, {at(5), 1}}, today, "")
+		assert.Equal(t, GoalCompleted, progress.Status)
+		assert.Equal(t, 100.0, progress.Percent)
+		require.NotNil(t, progress.CompletedAt)
+		assert.Equal(t, at(6), *progress.CompletedAt)
+	})
+
+	t.Run("weekly workouts from Sunday", func(t *testing.T) {
+		goal := &Goal{Title: "4 per week", Metric: GoalMetricWorkouts, Target: 4, Period: "week", StartDate: NewDate(2025, 1, 1)}
+		require.NoError(t, goal.Validate())
+
+		// Sunday 9th starts a new week, so Monday 3rd is in the previous one.
+		today := NewDate(2025, 3, 9)
+		start, end := goal.Window(today, "sunday")
+		assert.Equal(t, "2025-03-09", start.String())
+		assert.Equal(t, "2025-03-15", end.String())
+
+		start, end = goal.Window(NewDate(2025, 3, 8), "sunday")
+		assert.Equal(t, "2025-03-02", start.String())
+		assert.Equal(t, "2025-03-08", end.String())
+
+		progress := goal.Evaluate([]GoalContribution{{at(9), 1}}, today, "sunday")
+		assert.Equal(t, 25.0, progress.Percent)
+		assert.Equal(t, GoalOnTrack, progress.Status, "no day of the week has passed yet")
+	})
+
+	t.Run("lift by a deadline", func(t *testing.T) {
+		benchID := 7
+		goal := &Goal{Title: "Bench 100", Metric: GoalMetricLift, Target: 100, ExerciseID: &benchID,
+			StartDate: NewDate(2025, 1, 1), Deadline: NewDate(2025, 3, 31)}
+		require.NoError(t, goal.Validate())
+
+		progress := goal.Evaluate([]GoalContribution{{at(1), 90}, {at(8), 95}, {at(15), 92.5}}, NewDate(2025, 3, 20), "")
+		assert.Equal(t, 95.0, progress.Current)
+		assert.Equal(t, 95.0, progress.Percent)
+		assert.Equal(t, GoalOnTrack, progress.Status)
+
+		progress = goal.Evaluate([]GoalContribution{{at(8), 95}}, NewDate(2025, 4, 1), "")
+		assert.Equal(t, GoalMissed, progress.Status)
+	})
+
+	t.Run("weekly workouts between start date and deadline", func(t *testing.T) {
+		// Wednesday 5th to Wednesday 19th.
+		goal := &Goal{Title: "4 per week", Metric: GoalMetricWorkouts, Target: 4, Period: "week",
+			StartDate: NewDate(2025, 3, 5), Deadline: NewDate(2025, 3, 19)}
+		require.NoError(t, goal.Validate())
+
+		start, end := goal.Window(NewDate(2025, 3, 1), "")
+		assert.Equal(t, "2025-03-05", start.String(), "the first week before the start date")
+		assert.Equal(t, "2025-03-09", end.String())
+		progress := goal.Evaluate([]GoalContribution{{at(5), 1}}, NewDate(2025, 3, 1), "")
+		assert.Equal(t, 0.0, progress.Current, "no progress before the start date")
+		assert.Equal(t, GoalOnTrack, progress.Status)
+
+		start, _ = goal.Window(NewDate(2025, 3, 6), "")
+		assert.Equal(t, "2025-03-05", start.String(), "the week is cut to the start date")
+
+		start, end = goal.Window(NewDate(2025, 3, 25), "")
+		assert.Equal(t, "2025-03-17", start.String(), "the last week after the deadline")
+		assert.Equal(t, "2025-03-19", end.String(), "the week is cut to the deadline")
+
+		progress = goal.Evaluate([]GoalContribution{{at(17), 1}, {at(18), 1}}, NewDate(2025, 3, 25), "")
+		assert.Equal(t, GoalMissed, progress.Status)
+		progress = goal.Evaluate([]GoalContribution{{at(17), 2}, {at(18), 1}, {at(19), 1}}, NewDate(2025, 3, 25), "")
+		assert.Equal(t, GoalCompleted, progress.Status)
+	})
+
+	t.Run("lift goals need an exercise", func(t *testing.T) {
+		goal := &Goal{Title: "Bench 100", Metric: GoalMetricLift, Target: 100, StartDate: NewDate(2025, 1, 1)}
+		assert.ErrorIs(t, goal.Validate(), ErrInvalidGoal)
+	})
+}
+
+func TestComputeStreak(t *testing.T) {
+	days := []Date{
+		NewDate(2025, 3, 1), NewDate(2025, 3, 2), NewDate(2025, 3, 3), NewDate(2025, 3, 4), // 4 days
+		NewDate(2025, 3, 10), NewDate(2025, 3, 12), NewDate(2025, 3, 13),
+	}
+
+	streak := ComputeStreak(days, NewDate(2025, 3, 14), 0)
+	assert.Equal(t, 2, streak.Current)
+	assert.Equal(t, 4, streak.Longest)
+	assert.Equal(t, "2025-03-13", streak.LastWorkout.String())
+
+	streak = ComputeStreak(days, NewDate(2025, 3, 15), 0)
+	assert.Equal(t, 0, streak.Current, "a skipped day breaks the streak")
+
+	streak = ComputeStreak(days, NewDate(2025, 3, 15), 1)
+	assert.Equal(t, 4, streak.Current, "10th to 13th with one rest day")
+	assert.Equal(t, 4, streak.Longest)
+
+	streak = ComputeStreak(nil, NewDate(2025, 3, 15), 1)
+	assert.Equal(t, 0, streak.Current)
+	assert.Equal(t, 0, streak.Longest)
+}
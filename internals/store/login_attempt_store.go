@@ -0,0 +1,131 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// LoginThrottle decides how long a key has to wait after a number of
+// consecutive failed logins. The first FreeAttempts failures cost nothing,
+// then the delay doubles from one second, and LockoutAfter failures lock the
+// key for LockoutFor.
+type LoginThrottle struct {
+	FreeAttempts int
+	LockoutAfter int
+	LockoutFor   time.Duration
+}
+
+var (
+	AccountLoginThrottle = LoginThrottle{FreeAttempts: 3, LockoutAfter: 10, LockoutFor: 15 * time.Minute}
+	// Clients get more room, as several users can share an address.
+	IPLoginThrottle = LoginThrottle{FreeAttempts: 20, LockoutAfter: 100, LockoutFor: 15 * time.Minute}
+)
+
+// loginAttemptWindow is how long failures are remembered. A failure after a
+// quiet window starts counting from one again.
+const loginAttemptWindow = 24 * time.Hour
+
+func (t LoginThrottle) Delay(failures int) time.Duration {
+	if t.Locks(failures) {
+		return t.LockoutFor
+	}
+	if failures < t.FreeAttempts {
+		return 0
+	}
+	// Beyond 2^30 seconds the shift is past any lockout, and it overflows
+	// from 2^34 on.
+	doublings := failures - t.FreeAttempts
+	if doublings >= 30 {
+		return t.LockoutFor
+	}
+	return min(time.Second<<doublings, t.LockoutFor)
+}
+
+func (t LoginThrottle) Locks(failures int) bool {
+	return failures >= t.LockoutAfter
+}
+
+func AccountLoginKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+type PostgresLoginAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{
+		db: db,
+	}
+}
+
+type LoginAttemptStore interface {
+	// RetryAfter returns how long the longest waiting of keys still has to
+	// wait, zero when a login may be attempted now.
+	RetryAfter(keys ...string) (time.Duration, error)
+	// RecordFailure counts a failed login for key and returns the new number
+	// of consecutive failures.
+	RecordFailure(key string, throttle LoginThrottle) (int, error)
+	Reset(key string) error
+}
+
+func (s *PostgresLoginAttemptStore) RetryAfter(keys ...string) (time.Duration, error) {
+	query := `
+	SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - NOW()), 0)
+	FROM login_attempts
+	WHERE key = ANY($1) AND locked_until > NOW()
+	`
+	var seconds float64
+	err := s.db.QueryRow(query, keys).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (s *PostgresLoginAttemptStore) RecordFailure(key string, throttle LoginThrottle) (int, error) {
+	query := `
+	INSERT INTO login_attempts (key, failures, last_failure_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_attempts.last_failure_at < NOW() - $2 * INTERVAL '1 second' THEN 1
+			ELSE login_attempts.failures + 1
+		END,
+		last_failure_at = NOW()
+	RETURNING failures
+	`
+	var failures int
+	err := s.db.QueryRow(query, key, loginAttemptWindow.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := throttle.Delay(failures)
+	if delay == 0 {
+		return failures, nil
+	}
+	query = `UPDATE login_attempts SET locked_until = NOW() + $2 * INTERVAL '1 second' WHERE key = $1`
+	_, err = s.db.Exec(query, key, delay.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+// Reset forgets the failures of key after a successful login, and cleans up
+// keys that have been quiet for a while.
+func (s *PostgresLoginAttemptStore) Reset(key string) error {
+	query := `
+	DELETE FROM login_attempts
+	WHERE key = $1
+	OR (last_failure_at < NOW() - $2 * INTERVAL '1 second' AND (locked_until IS NULL OR locked_until < NOW()))
+	`
+	_, err := s.db.Exec(query, key, loginAttemptWindow.Seconds())
+	return err
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottleDelay(t *testing.T) {
+	throttle := LoginThrottle{FreeAttempts: 3, LockoutAfter: 10, LockoutFor: 15 * time.Minute}
+
+	assert.Equal(t, time.Duration(0), throttle.Delay(0))
+	assert.Equal(t, time.Duration(0), throttle.Delay(2))
+	assert.Equal(t, time.Second, throttle.Delay(3))
+	assert.Equal(t, 2*time.Second, throttle.Delay(4))
+	assert.Equal(t, 64*time.Second, throttle.Delay(9))
+	assert.False(t, throttle.Locks(9))
+
+	assert.Equal(t, 15*time.Minute, throttle.Delay(10))
+	assert.True(t, throttle.Locks(10))
+	assert.Equal(t, 15*time.Minute, throttle.Delay(50))
+
+	// The backoff never exceeds the lockout.
+	wide := LoginThrottle{FreeAttempts: 1, LockoutAfter: 100, LockoutFor: time.Minute}
+	assert.Equal(t, time.Minute, wide.Delay(20))
+}
+
+func TestLoginThrottleDelayUpToLockout(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle LoginThrottle
+	}{
+		{name: "account", throttle: AccountLoginThrottle},
+		{name: "ip", throttle: IPLoginThrottle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := time.Duration(0)
+			for failures := 0; failures <= tt.throttle.LockoutAfter; failures++ {
+				delay := tt.throttle.Delay(failures)
+				if failures < tt.throttle.FreeAttempts {
+					assert.Zero(t, delay, "failure %d", failures)
+					continue
+				}
+				assert.Positive(t, delay, "failure %d", failures)
+				assert.GreaterOrEqual(t, delay, previous, "failure %d", failures)
+				assert.LessOrEqual(t, delay, tt.throttle.LockoutFor, "failure %d", failures)
+				previous = delay
+			}
+			assert.Equal(t, tt.throttle.LockoutFor, tt.throttle.Delay(tt.throttle.LockoutAfter))
+		})
+	}
+
+	assert.Equal(t, 15*time.Minute, IPLoginThrottle.Delay(54))
+	assert.Equal(t, 15*time.Minute, IPLoginThrottle.Delay(90))
+}
+
+func TestLoginKeys(t *testing.T) {
+	assert.Equal(t, "email:jane@example.com", AccountLoginKey("  Jane@Example.com "))
+	assert.Equal(t, "ip:192.0.2.1", IPLoginKey("192.0.2.1"))
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"go_beginner/internals/totp"
+)
+
+const recoveryCodeCount = 10
+
+var ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// UserMFA is the TOTP two-factor setup of a user. It is pending until the
+// user confirms it with a first code.
+type UserMFA struct {
+	UserID            int        `json:"-"`
+	Secret            []byte     `json:"-"`
+	Enabled           bool       `json:"enabled"`
+	LastUsedStep      int64      `json:"-"`
+	EnabledAt         *time.Time `json:"enabled_at"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
+
+// GenerateRecoveryCodes returns one-time codes like "k3j9x-2mq7z" that log in
+// in place of a TOTP code.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+type PostgresMFAStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMFAStore(db *sql.DB) *PostgresMFAStore {
+	return &PostgresMFAStore{
+		db: db,
+	}
+}
+
+type MFAStore interface {
+	// GetMFA returns nil when the user has not started setting up 2FA.
+	GetMFA(userID int) (*UserMFA, error)
+	// BeginMFA stores a new pending secret, replacing an earlier pending one.
+	BeginMFA(userID int, secret []byte) error
+	// ConfirmMFA enables the pending setup when code is valid and stores the
+	// recovery codes. It reports whether the code was accepted.
+	ConfirmMFA(userID int, code string, recoveryCodes []string) (bool, error)
+	// VerifyCode checks a TOTP code or an unused recovery code of an enabled
+	// setup. Each code is accepted once.
+	VerifyCode(userID int, code string) (bool, error)
+	DisableMFA(userID int) error
+}
+
+func (s *PostgresMFAStore) GetMFA(userID int) (*UserMFA, error) {
+	query := `
+	SELECT m.user_id, m.secret, m.enabled, m.last_used_step, m.enabled_at,
+		(SELECT COUNT(*) FROM mfa_recovery_codes c WHERE c.user_id = m.user_id AND c.used_at IS NULL)
+	FROM user_mfa m
+	WHERE m.user_id = $1
+	`
+	var mfa UserMFA
+	err := s.db.QueryRow(query, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep, &mfa.EnabledAt, &mfa.RecoveryCodesLeft)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func (s *PostgresMFAStore) BeginMFA(userID int, secret []byte) error {
+	query := `
+	INSERT INTO user_mfa (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+	WHERE NOT user_mfa.enabled
+	`
+	result, err := s.db.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *PostgresMFAStore) ConfirmMFA(userID int, code string, recoveryCodes []string) (bool, error) {
+	mfa, err := s.GetMFA(userID)
+	if err != nil {
+		return false, err
+	}
+	if mfa == nil {
+		return false, nil
+	}
+	if mfa.Enabled {
+		return false, ErrMFAAlreadyEnabled
+	}
+	step, ok := totp.Validate(mfa.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	hashes := make([]password, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		err := hashes[i].Set(normalizeRecoveryCode(code))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE user_mfa SET enabled = true, enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND NOT enabled AND secret = $3`, userID, step, mfa.Secret)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		// Confirmed concurrently, or a new secret was requested meanwhile.
+		return false, nil
+	}
+	_, err = tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, hash := range hashes {
+		_, err = tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hash.hash)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *PostgresMFAStore) VerifyCode(userID int, code string) (bool, error) {
+	mfa, err := s.GetMFA(userID)
+	if err != nil {
+		return false, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(mfa.Secret, code, time.Now()); ok {
+		// Only a step after the last used one counts, so that an
+		// intercepted code cannot be replayed.
+		result, err := s.db.Exec(`UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+	return s.useRecoveryCode(userID, normalizeRecoveryCode(code))
+}
+
+func (s *PostgresMFAStore) useRecoveryCode(userID int, code string) (bool, error) {
+	if len(code) != 10 {
+		return false, nil
+	}
+	rows, err := s.db.Query(`SELECT id, hash FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	matched := 0
+	for rows.Next() {
+		var id int
+		var hash password
+		err := rows.Scan(&id, &hash.hash)
+		if err != nil {
+			return false, err
+		}
+		ok, err := hash.Check(code)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched = id
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+	if matched == 0 {
+		return false, nil
+	}
+
+	result, err := s.db.Exec(`UPDATE mfa_recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, matched)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *PostgresMFAStore) DisableMFA(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
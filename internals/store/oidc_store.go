@@ -0,0 +1,87 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"time"
+
+	"go_beginner/internals/oidc"
+)
+
+// OIDCAuthRequestTTL is how long a user has to log in at the provider.
+const OIDCAuthRequestTTL = 10 * time.Minute
+
+type PostgresOIDCStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOIDCStore(db *sql.DB) *PostgresOIDCStore {
+	return &PostgresOIDCStore{
+		db: db,
+	}
+}
+
+type OIDCStore interface {
+	// SaveAuthRequest remembers an authorization request until its callback.
+	SaveAuthRequest(req *oidc.AuthRequest, ttl time.Duration) error
+	// ConsumeAuthRequest returns the unexpired request with state and
+	// forgets it, so each callback is accepted once. It returns nil when
+	// there is no such request.
+	ConsumeAuthRequest(state string) (*oidc.AuthRequest, error)
+	// GetUserIDForIdentity returns 0 when the identity is not linked.
+	GetUserIDForIdentity(issuer, subject string) (int, error)
+	LinkIdentity(userID int, issuer, subject string) error
+}
+
+func (s *PostgresOIDCStore) SaveAuthRequest(req *oidc.AuthRequest, ttl time.Duration) error {
+	stateHash := sha256.Sum256([]byte(req.State))
+	query := `
+	INSERT INTO oidc_auth_requests (state_hash, nonce, code_verifier, expiry)
+	VALUES ($1, $2, $3, $4)
+	`
+	_, err := s.db.Exec(query, stateHash[:], req.Nonce, req.Verifier, time.Now().Add(ttl))
+	if err != nil {
+		return err
+	}
+	// Abandoned logins are cleaned up as new ones start.
+	_, err = s.db.Exec(`DELETE FROM oidc_auth_requests WHERE expiry < NOW()`)
+	return err
+}
+
+func (s *PostgresOIDCStore) ConsumeAuthRequest(state string) (*oidc.AuthRequest, error) {
+	stateHash := sha256.Sum256([]byte(state))
+	query := `
+	DELETE FROM oidc_auth_requests
+	WHERE state_hash = $1 AND expiry > NOW()
+	RETURNING nonce, code_verifier
+	`
+	req := oidc.AuthRequest{State: state}
+	err := s.db.QueryRow(query, stateHash[:]).Scan(&req.Nonce, &req.Verifier)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *PostgresOIDCStore) GetUserIDForIdentity(issuer, subject string) (int, error) {
+	query := `SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2`
+	var userID int
+	err := s.db.QueryRow(query, issuer, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userID, err
+}
+
+func (s *PostgresOIDCStore) LinkIdentity(userID int, issuer, subject string) error {
+	query := `
+	INSERT INTO user_identities (user_id, issuer, subject)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (issuer, subject) DO NOTHING
+	`
+	_, err := s.db.Exec(query, userID, issuer, subject)
+	return err
+}
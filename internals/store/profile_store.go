@@ -0,0 +1,175 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidProfile = errors.New("invalid profile")
+
+const (
+	WeightUnitKg   = "kg"
+	WeightUnitLb   = "lb"
+	DistanceUnitKm = "km"
+	DistanceUnitMi = "mi"
+)
+
+// UserProfile holds the optional details and preferences of a user.
+// Measurements are metric; WeightUnit and DistanceUnit only tell clients how
+// to display them.
+type UserProfile struct {
+	UserID       int        `json:"-"`
+	WeightUnit   string     `json:"weight_unit"`   // kg or lb
+	DistanceUnit string     `json:"distance_unit"` // km or mi
+	DateOfBirth  Date       `json:"date_of_birth"`
+	HeightCm     *float64   `json:"height_cm"`
+	Sex          *string    `json:"sex"` // female, male or other
+	BodyWeightKg *float64   `json:"body_weight_kg"`
+	Timezone     string     `json:"timezone"`   // IANA name, e.g. "Europe/Berlin"
+	WeekStart    string     `json:"week_start"` // lowercase weekday, e.g. "monday"
+	UpdatedAt    *time.Time `json:"updated_at"` // nil until the profile is first saved
+}
+
+// DefaultProfile is the profile of a user who has not set one.
+func DefaultProfile(userID int) *UserProfile {
+	return &UserProfile{
+		UserID:       userID,
+		WeightUnit:   WeightUnitKg,
+		DistanceUnit: DistanceUnitKm,
+		Timezone:     "UTC",
+		WeekStart:    "monday",
+	}
+}
+
+func (p *UserProfile) Validate() error {
+	if p.WeightUnit != WeightUnitKg && p.WeightUnit != WeightUnitLb {
+		return fmt.Errorf("%w: weight_unit must be kg or lb", ErrInvalidProfile)
+	}
+	if p.DistanceUnit != DistanceUnitKm && p.DistanceUnit != DistanceUnitMi {
+		return fmt.Errorf("%w: distance_unit must be km or mi", ErrInvalidProfile)
+	}
+	if !p.DateOfBirth.IsZero() && (p.DateOfBirth.Year() < 1900 || p.DateOfBirth.After(time.Now())) {
+		return fmt.Errorf("%w: date_of_birth must be between 1900 and today", ErrInvalidProfile)
+	}
+	if p.HeightCm != nil && (*p.HeightCm < 50 || *p.HeightCm > 275) {
+		return fmt.Errorf("%w: height_cm must be between 50 and 275", ErrInvalidProfile)
+	}
+	if p.Sex != nil && *p.Sex != "female" && *p.Sex != "male" && *p.Sex != "other" {
+		return fmt.Errorf("%w: sex must be female, male or other", ErrInvalidProfile)
+	}
+	if p.BodyWeightKg != nil && (*p.BodyWeightKg < 20 || *p.BodyWeightKg > 500) {
+		return fmt.Errorf("%w: body_weight_kg must be between 20 and 500", ErrInvalidProfile)
+	}
+	if _, err := LoadTimezone(p.Timezone); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	if _, err := ParseWeekday(p.WeekStart); err != nil {
+		return fmt.Errorf("%w: week_start %v", ErrInvalidProfile, err)
+	}
+	return nil
+}
+
+// Location is the profile's timezone, UTC if it cannot be loaded.
+func (p *UserProfile) Location() *time.Location {
+	loc, err := LoadTimezone(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseWeekday parses a weekday name like "monday", in any case.
+func ParseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("must be a weekday like \"monday\", not %q", name)
+}
+
+// daysAfterMonday is how many days after Monday weeks starting on the named
+// day start, 0 when the name is empty or unknown.
+func daysAfterMonday(weekStart string) int {
+	day, err := ParseWeekday(weekStart)
+	if err != nil {
+		return 0
+	}
+	return (int(day) + 6) % 7
+}
+
+// caloriesMET is the metabolic equivalent of moderate to vigorous resistance
+// training.
+const caloriesMET = 5.0
+
+// EstimateCalories estimates the calories a workout burned from its duration
+// and the body weight of the user, 0 when the duration is not known.
+func EstimateCalories(durationMinutes int, bodyWeightKg float64) int {
+	if durationMinutes <= 0 {
+		return 0
+	}
+	return int(caloriesMET*bodyWeightKg*float64(durationMinutes)/60 + 0.5)
+}
+
+type PostgresProfileStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProfileStore(db *sql.DB) *PostgresProfileStore {
+	return &PostgresProfileStore{
+		db: db,
+	}
+}
+
+type ProfileStore interface {
+	// GetProfile returns DefaultProfile for users who have not saved one.
+	GetProfile(userID int) (*UserProfile, error)
+	UpdateProfile(profile *UserProfile) error
+}
+
+func (s *PostgresProfileStore) GetProfile(userID int) (*UserProfile, error) {
+	query := `
+	SELECT weight_unit, distance_unit, date_of_birth, height_cm, sex, body_weight_kg, timezone, week_start, updated_at
+	FROM user_profiles
+	WHERE user_id = $1
+	`
+	profile := UserProfile{UserID: userID}
+	err := s.db.QueryRow(query, userID).Scan(&profile.WeightUnit, &profile.DistanceUnit, &profile.DateOfBirth,
+		&profile.HeightCm, &profile.Sex, &profile.BodyWeightKg, &profile.Timezone, &profile.WeekStart, &profile.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return DefaultProfile(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (s *PostgresProfileStore) UpdateProfile(profile *UserProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	profile.WeekStart = strings.ToLower(profile.WeekStart)
+	query := `
+	INSERT INTO user_profiles (user_id, weight_unit, distance_unit, date_of_birth, height_cm, sex, body_weight_kg,
+		timezone, week_start)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (user_id) DO UPDATE SET
+		weight_unit = EXCLUDED.weight_unit,
+		distance_unit = EXCLUDED.distance_unit,
+		date_of_birth = EXCLUDED.date_of_birth,
+		height_cm = EXCLUDED.height_cm,
+		sex = EXCLUDED.sex,
+		body_weight_kg = EXCLUDED.body_weight_kg,
+		timezone = EXCLUDED.timezone,
+		week_start = EXCLUDED.week_start,
+		updated_at = NOW()
+	RETURNING updated_at
+	`
+	return s.db.QueryRow(query, profile.UserID, profile.WeightUnit, profile.DistanceUnit, profile.DateOfBirth,
+		profile.HeightCm, profile.Sex, profile.BodyWeightKg, profile.Timezone, profile.WeekStart).
+		Scan(&profile.UpdatedAt)
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileValidate(t *testing.T) {
+	height := 180.0
+	light := 10.0
+	sex := "unknown"
+
+	tests := []struct {
+		name    string
+		change  func(p *UserProfile)
+		wantErr bool
+	}{
+		{name: "defaults", change: func(p *UserProfile) {}},
+		{name: "imperial units", change: func(p *UserProfile) { p.WeightUnit, p.DistanceUnit = WeightUnitLb, DistanceUnitMi }},
+		{name: "body measurements", change: func(p *UserProfile) { p.HeightCm = &height; p.DateOfBirth = NewDate(1990, time.May, 1) }},
+		{name: "week start in any case", change: func(p *UserProfile) { p.WeekStart = "Sunday" }},
+		{name: "unknown weight unit", change: func(p *UserProfile) { p.WeightUnit = "stone" }, wantErr: true},
+		{name: "unknown distance unit", change: func(p *UserProfile) { p.DistanceUnit = "yd" }, wantErr: true},
+		{name: "born in the future", change: func(p *UserProfile) { p.DateOfBirth = DateIn(time.Now().AddDate(0, 0, 2), time.UTC) }, wantErr: true},
+		{name: "body weight out of range", change: func(p *UserProfile) { p.BodyWeightKg = &light }, wantErr: true},
+		{name: "unknown sex", change: func(p *UserProfile) { p.Sex = &sex }, wantErr: true},
+		{name: "unknown timezone", change: func(p *UserProfile) { p.Timezone = "Mars/Olympus" }, wantErr: true},
+		{name: "unknown week start", change: func(p *UserProfile) { p.WeekStart = "funday" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := DefaultProfile(1)
+			tt.change(profile)
+			err := profile.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidProfile)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	day, err := ParseWeekday("SATURDAY")
+	require.NoError(t, err)
+	assert.Equal(t, time.Saturday, day)
+
+	_, err = ParseWeekday("sat")
+	assert.Error(t, err)
+
+	assert.Equal(t, 0, daysAfterMonday("monday"))
+	assert.Equal(t, 5, daysAfterMonday("saturday"))
+	assert.Equal(t, 6, daysAfterMonday("sunday"))
+	assert.Equal(t, 0, daysAfterMonday(""))
+}
+
+func TestEstimateCalories(t *testing.T) {
+	assert.Equal(t, 400, EstimateCalories(60, 80))
+	assert.Equal(t, 164, EstimateCalories(30, 65.5))
+	assert.Equal(t, 0, EstimateCalories(0, 80))
+}
+
+func TestWorkoutDuration(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 18, 0, 0, 0, time.UTC)
+	end := start.Add(47*time.Minute + 40*time.Second)
+
+	assert.Equal(t, 48, (&Workout{StartedAt: &start, EndedAt: &end}).Duration())
+	assert.Equal(t, 30, (&Workout{DurationMinutes: 30, StartedAt: &start, EndedAt: &end}).Duration())
+	assert.Equal(t, 0, (&Workout{StartedAt: &start}).Duration())
+}
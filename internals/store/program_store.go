@@ -0,0 +1,560 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidProgram  = errors.New("invalid program")
+	ErrAlreadyEnrolled = errors.New("already enrolled in a program")
+)
+
+const (
+	EnrollmentActive    = "active"
+	EnrollmentCancelled = "cancelled"
+)
+
+// Program is a multi-week training plan. Each scheduled day prescribes a
+// workout template, and progression rules raise the template weights week
+// over week.
+type Program struct {
+	ID           int               `json:"id"`
+	UserID       int               `json:"user_id"` // author
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	Weeks        int               `json:"weeks"`
+	Days         []ProgramDay      `json:"days"`
+	Progressions []ProgressionRule `json:"progressions"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+type ProgramDay struct {
+	ID         int    `json:"id"`
+	Week       int    `json:"week"` // 1-based
+	Day        int    `json:"day"`  // 1-7, relative to the enrollment start date
+	TemplateID int    `json:"template_id"`
+	Title      string `json:"title"`
+}
+
+// Offset is the number of days between the program start and this day.
+func (d ProgramDay) Offset() int {
+	return (d.Week-1)*7 + d.Day - 1
+}
+
+// ProgressionRule adds IncrementKg to the target weight of an exercise every
+// EveryWeeks weeks.
+type ProgressionRule struct {
+	ID           int     `json:"id"`
+	ExerciseID   *int    `json:"exercise_id"`
+	ExerciseName string  `json:"exercise_name"`
+	IncrementKg  float64 `json:"increment_kg"`
+	EveryWeeks   int     `json:"every_weeks"`
+}
+
+func (p *Program) OwnerID() int { return p.UserID }
+
+func (p *Program) Validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProgram)
+	}
+	if p.Weeks < 1 || p.Weeks > 52 {
+		return fmt.Errorf("%w: weeks must be between 1 and 52", ErrInvalidProgram)
+	}
+	if len(p.Days) == 0 {
+		return fmt.Errorf("%w: at least one day is required", ErrInvalidProgram)
+	}
+	seen := map[[2]int]bool{}
+	for _, day := range p.Days {
+		if day.Week < 1 || day.Week > p.Weeks {
+			return fmt.Errorf("%w: week %d is outside the program", ErrInvalidProgram, day.Week)
+		}
+		if day.Day < 1 || day.Day > 7 {
+			return fmt.Errorf("%w: day must be between 1 and 7", ErrInvalidProgram)
+		}
+		if seen[[2]int{day.Week, day.Day}] {
+			return fmt.Errorf("%w: week %d day %d is scheduled twice", ErrInvalidProgram, day.Week, day.Day)
+		}
+		seen[[2]int{day.Week, day.Day}] = true
+	}
+	for i := range p.Progressions {
+		rule := &p.Progressions[i]
+		if rule.ExerciseID == nil && strings.TrimSpace(rule.ExerciseName) == "" {
+			return fmt.Errorf("%w: progression %d: exercise_name or exercise_id is required", ErrInvalidProgram, i+1)
+		}
+		if rule.EveryWeeks == 0 {
+			rule.EveryWeeks = 1
+		}
+		if rule.EveryWeeks < 1 {
+			return fmt.Errorf("%w: progression %d: every_weeks must be at least 1", ErrInvalidProgram, i+1)
+		}
+	}
+	return nil
+}
+
+// FindDay returns the day scheduled at the given offset from the start, nil
+// for a rest day.
+func (p *Program) FindDay(offset int) *ProgramDay {
+	for i := range p.Days {
+		if p.Days[i].Offset() == offset {
+			return &p.Days[i]
+		}
+	}
+	return nil
+}
+
+// Prescribe applies the progression rules for the given week to the entries
+// of a day's template.
+func (p *Program) Prescribe(week int, template *WorkoutTemplate) []TemplateEntry {
+	entries := make([]TemplateEntry, len(template.Entries))
+	for i, entry := range template.Entries {
+		entries[i] = entry
+		if entry.TargetWeightKg == nil {
+			continue
+		}
+		weight := *entry.TargetWeightKg
+		for _, rule := range p.Progressions {
+			match := TemplateEntry{ExerciseID: rule.ExerciseID, ExerciseName: rule.ExerciseName}
+			if match.matches(WorkoutEntry{ExerciseID: entry.ExerciseID, ExerciseName: entry.ExerciseName}) {
+				weight += rule.IncrementKg * float64((week-1)/rule.EveryWeeks)
+			}
+		}
+		weight = math.Round(weight*100) / 100
+		entries[i].TargetWeightKg = &weight
+	}
+	return entries
+}
+
+type ProgramEnrollment struct {
+	ID          int                    `json:"id"`
+	UserID      int                    `json:"user_id"`
+	ProgramID   int                    `json:"program_id"`
+	StartDate   Date                   `json:"start_date"`
+	Timezone    string                 `json:"timezone"`
+	Status      string                 `json:"status"`
+	CreatedAt   time.Time              `json:"created_at"`
+	Completions []ProgramDayCompletion `json:"completions"`
+}
+
+type ProgramDayCompletion struct {
+	ProgramDayID int       `json:"program_day_id"`
+	WorkoutID    int       `json:"workout_id"`
+	CompletedAt  time.Time `json:"completed_at"`
+}
+
+func (e *ProgramEnrollment) Completion(programDayID int) *ProgramDayCompletion {
+	for i := range e.Completions {
+		if e.Completions[i].ProgramDayID == programDayID {
+			return &e.Completions[i]
+		}
+	}
+	return nil
+}
+
+// ProgramPosition is where an enrollment stands on a given calendar day.
+type ProgramPosition struct {
+	Date     Date        `json:"date"`
+	Week     int         `json:"week"`
+	Day      int         `json:"day"`
+	Started  bool        `json:"started"`
+	Finished bool        `json:"finished"`
+	Session  *ProgramDay `json:"session"` // nil on rest days
+}
+
+func (e *ProgramEnrollment) Position(program *Program, today Date) ProgramPosition {
+	offset := today.DaysSince(e.StartDate)
+	position := ProgramPosition{
+		Date:     today,
+		Started:  offset >= 0,
+		Finished: offset >= program.Weeks*7,
+	}
+	if !position.Started || position.Finished {
+		return position
+	}
+	position.Week = offset/7 + 1
+	position.Day = offset%7 + 1
+	position.Session = program.FindDay(offset)
+	return position
+}
+
+type ProgramAdherence struct {
+	ScheduledDays int     `json:"scheduled_days"` // in the whole program
+	DueDays       int     `json:"due_days"`       // scheduled up to today
+	CompletedDays int     `json:"completed_days"`
+	Percent       float64 `json:"percent"` // completed out of due days
+}
+
+// Adherence compares the completed days with the days that were due by
+// today. Today only counts as due once it has been completed.
+func (e *ProgramEnrollment) Adherence(program *Program, today Date) ProgramAdherence {
+	adherence := ProgramAdherence{ScheduledDays: len(program.Days), Percent: 100}
+	offset := today.DaysSince(e.StartDate)
+	for _, day := range program.Days {
+		completed := e.Completion(day.ID) != nil
+		if completed {
+			adherence.CompletedDays++
+		}
+		if day.Offset() < offset || day.Offset() == offset && completed {
+			adherence.DueDays++
+		}
+	}
+	if adherence.DueDays > 0 {
+		due := min(adherence.CompletedDays, adherence.DueDays)
+		adherence.Percent = math.Round(float64(due)/float64(adherence.DueDays)*1000) / 10
+	}
+	return adherence
+}
+
+type PostgresProgramStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProgramStore(db *sql.DB) *PostgresProgramStore {
+	return &PostgresProgramStore{
+		db: db,
+	}
+}
+
+type ProgramStore interface {
+	CreateProgram(*Program) (*Program, error)
+	GetProgramByID(id int) (*Program, error)
+	ListPrograms() ([]Program, error)
+	DeleteProgram(id int) error
+	Enroll(*ProgramEnrollment) (*ProgramEnrollment, error)
+	GetActiveEnrollment(userID int) (*ProgramEnrollment, error)
+	CancelEnrollment(id int) error
+}
+
+func (pg *PostgresProgramStore) CreateProgram(program *Program) (*Program, error) {
+	if err := program.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO programs (user_id, name, description, weeks)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, program.UserID, program.Name, program.Description, program.Weeks).Scan(
+		&program.ID,
+		&program.CreatedAt,
+		&program.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range program.Days {
+		day := &program.Days[i]
+		var templateOwner int
+		err = tx.QueryRow(`SELECT user_id FROM workout_templates WHERE id = $1 FOR SHARE`, day.TemplateID).Scan(&templateOwner)
+		if err == sql.ErrNoRows || err == nil && templateOwner != program.UserID {
+			return nil, fmt.Errorf("%w: unknown template_id %d", ErrInvalidProgram, day.TemplateID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = tx.QueryRow(`
+			INSERT INTO program_days (program_id, week, day, template_id, title)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, program.ID, day.Week, day.Day, day.TemplateID, day.Title).Scan(&day.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range program.Progressions {
+		rule := &program.Progressions[i]
+		exerciseID, exerciseName, err := linkExercise(tx, rule.ExerciseID, rule.ExerciseName, program.UserID)
+		if errors.Is(err, ErrInvalidWorkout) {
+			return nil, fmt.Errorf("%w: unknown exercise_id %d", ErrInvalidProgram, *rule.ExerciseID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rule.ExerciseID, rule.ExerciseName = exerciseID, exerciseName
+		err = tx.QueryRow(`
+			INSERT INTO program_progressions (program_id, exercise_id, exercise_name, increment_kg, every_weeks)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, program.ID, rule.ExerciseID, rule.ExerciseName, rule.IncrementKg, rule.EveryWeeks).Scan(&rule.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func (pg *PostgresProgramStore) GetProgramByID(id int) (*Program, error) {
+	query := `
+		SELECT id, user_id, name, description, weeks, created_at, updated_at
+		FROM programs
+		WHERE id = $1
+	`
+	program := Program{}
+	err := pg.db.QueryRow(query, id).Scan(
+		&program.ID,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.CreatedAt,
+		&program.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	programs := []Program{program}
+	err = pg.loadProgramSchedules(programs)
+	if err != nil {
+		return nil, err
+	}
+	return &programs[0], nil
+}
+
+func (pg *PostgresProgramStore) ListPrograms() ([]Program, error) {
+	query := `
+		SELECT id, user_id, name, description, weeks, created_at, updated_at
+		FROM programs
+		ORDER BY name, id
+	`
+	rows, err := pg.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query programs: %w", err)
+	}
+	defer rows.Close()
+
+	programs := []Program{}
+	for rows.Next() {
+		program := Program{}
+		err = rows.Scan(
+			&program.ID,
+			&program.UserID,
+			&program.Name,
+			&program.Description,
+			&program.Weeks,
+			&program.CreatedAt,
+			&program.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan program: %w", err)
+		}
+		programs = append(programs, program)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over programs: %w", err)
+	}
+
+	err = pg.loadProgramSchedules(programs)
+	if err != nil {
+		return nil, err
+	}
+	return programs, nil
+}
+
+// loadProgramSchedules fills in the days and progression rules of the given
+// programs.
+func (pg *PostgresProgramStore) loadProgramSchedules(programs []Program) error {
+	if len(programs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(programs))
+	byID := make(map[int]*Program, len(programs))
+	for i := range programs {
+		ids[i] = int64(programs[i].ID)
+		byID[programs[i].ID] = &programs[i]
+		programs[i].Days = []ProgramDay{}
+		programs[i].Progressions = []ProgressionRule{}
+	}
+
+	rows, err := pg.db.Query(`
+		SELECT program_id, id, week, day, template_id, title
+		FROM program_days
+		WHERE program_id = ANY($1)
+		ORDER BY program_id, week, day
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query program days: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var programID int
+		day := ProgramDay{}
+		err = rows.Scan(&programID, &day.ID, &day.Week, &day.Day, &day.TemplateID, &day.Title)
+		if err != nil {
+			return fmt.Errorf("failed to scan program day: %w", err)
+		}
+		byID[programID].Days = append(byID[programID].Days, day)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over program days: %w", err)
+	}
+
+	ruleRows, err := pg.db.Query(`
+		SELECT program_id, id, exercise_id, exercise_name, increment_kg, every_weeks
+		FROM program_progressions
+		WHERE program_id = ANY($1)
+		ORDER BY program_id, id
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query program progressions: %w", err)
+	}
+	defer ruleRows.Close()
+	for ruleRows.Next() {
+		var programID int
+		rule := ProgressionRule{}
+		err = ruleRows.Scan(&programID, &rule.ID, &rule.ExerciseID, &rule.ExerciseName, &rule.IncrementKg, &rule.EveryWeeks)
+		if err != nil {
+			return fmt.Errorf("failed to scan program progression: %w", err)
+		}
+		byID[programID].Progressions = append(byID[programID].Progressions, rule)
+	}
+	if err = ruleRows.Err(); err != nil {
+		return fmt.Errorf("error iterating over program progressions: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresProgramStore) DeleteProgram(id int) error {
+	res, err := pg.db.Exec(`DELETE FROM programs WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("program with ID %d not found", id)
+	}
+	return nil
+}
+
+func (pg *PostgresProgramStore) Enroll(enrollment *ProgramEnrollment) (*ProgramEnrollment, error) {
+	if enrollment.Timezone == "" {
+		enrollment.Timezone = "UTC"
+	}
+	if _, err := LoadTimezone(enrollment.Timezone); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProgram, err)
+	}
+	if enrollment.StartDate.IsZero() {
+		return nil, fmt.Errorf("%w: start_date is required", ErrInvalidProgram)
+	}
+
+	query := `
+		INSERT INTO program_enrollments (user_id, program_id, start_date, timezone)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, created_at
+	`
+	err := pg.db.QueryRow(query, enrollment.UserID, enrollment.ProgramID, enrollment.StartDate, enrollment.Timezone).Scan(
+		&enrollment.ID,
+		&enrollment.Status,
+		&enrollment.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	enrollment.Completions = []ProgramDayCompletion{}
+	return enrollment, nil
+}
+
+func (pg *PostgresProgramStore) GetActiveEnrollment(userID int) (*ProgramEnrollment, error) {
+	query := `
+		SELECT id, user_id, program_id, start_date, timezone, status, created_at
+		FROM program_enrollments
+		WHERE user_id = $1 AND status = 'active'
+	`
+	enrollment := &ProgramEnrollment{Completions: []ProgramDayCompletion{}}
+	err := pg.db.QueryRow(query, userID).Scan(
+		&enrollment.ID,
+		&enrollment.UserID,
+		&enrollment.ProgramID,
+		&enrollment.StartDate,
+		&enrollment.Timezone,
+		&enrollment.Status,
+		&enrollment.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pg.db.Query(`
+		SELECT program_day_id, workout_id, completed_at
+		FROM program_day_completions
+		WHERE enrollment_id = $1
+		ORDER BY completed_at
+	`, enrollment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query program completions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		completion := ProgramDayCompletion{}
+		err = rows.Scan(&completion.ProgramDayID, &completion.WorkoutID, &completion.CompletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan program completion: %w", err)
+		}
+		enrollment.Completions = append(enrollment.Completions, completion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over program completions: %w", err)
+	}
+	return enrollment, nil
+}
+
+func (pg *PostgresProgramStore) CancelEnrollment(id int) error {
+	_, err := pg.db.Exec(`UPDATE program_enrollments SET status = 'cancelled' WHERE id = $1`, id)
+	return err
+}
+
+// recordProgramCompletion marks the program day a workout was logged against
+// as completed in the user's active enrollment.
+func recordProgramCompletion(tx *sql.Tx, workout *Workout) error {
+	if workout.ProgramDayID == nil {
+		return nil
+	}
+	query := `
+		INSERT INTO program_day_completions (enrollment_id, program_day_id, workout_id)
+		SELECT e.id, d.id, $3
+		FROM program_enrollments e
+		JOIN program_days d ON d.program_id = e.program_id
+		WHERE e.user_id = $1 AND e.status = 'active' AND d.id = $2
+		ON CONFLICT (enrollment_id, program_day_id)
+		DO UPDATE SET workout_id = EXCLUDED.workout_id, completed_at = NOW()
+	`
+	res, err := tx.Exec(query, workout.UserId, *workout.ProgramDayID, workout.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: program_day_id %d is not part of your active program", ErrInvalidWorkout, *workout.ProgramDayID)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgramSchedule(t *testing.T) {
+	squatID := 4
+	program := &Program{
+		Name:  "5x5",
+		Weeks: 2,
+		Days: []ProgramDay{
+			{ID: 1, Week: 1, Day: 1, TemplateID: 10},
+			{ID: 2, Week: 1, Day: 3, TemplateID: 11},
+			{ID: 3, Week: 2, Day: 1, TemplateID: 10},
+		},
+		Progressions: []ProgressionRule{
+			{ExerciseID: &squatID, ExerciseName: "Back Squat", IncrementKg: 2.5, EveryWeeks: 1},
+		},
+	}
+	require.NoError(t, program.Validate())
+
+	t.Run("applies progression per week", func(t *testing.T) {
+		template := &WorkoutTemplate{Entries: []TemplateEntry{
+			{ExerciseID: &squatID, ExerciseName: "Squat", TargetWeightKg: Float64Ptr(100)},
+			{ExerciseName: "Plank", TargetDurationSeconds: IntPtr(60)},
+		}}
+		week1 := program.Prescribe(1, template)
+		week2 := program.Prescribe(2, template)
+		assert.Equal(t, Float64Ptr(100), week1[0].TargetWeightKg)
+		assert.Equal(t, Float64Ptr(102.5), week2[0].TargetWeightKg)
+		assert.Nil(t, week2[1].TargetWeightKg)
+		assert.Equal(t, Float64Ptr(100), template.Entries[0].TargetWeightKg, "template must not change")
+	})
+
+	enrollment := &ProgramEnrollment{StartDate: NewDate(2025, 3, 3)}
+
+	t.Run("finds today's session", func(t *testing.T) {
+		position := enrollment.Position(program, NewDate(2025, 3, 5))
+		assert.Equal(t, 1, position.Week)
+		assert.Equal(t, 3, position.Day)
+		require.NotNil(t, position.Session)
+		assert.Equal(t, 2, position.Session.ID)
+
+		rest := enrollment.Position(program, NewDate(2025, 3, 4))
+		assert.True(t, rest.Started)
+		assert.Nil(t, rest.Session)
+
+		assert.False(t, enrollment.Position(program, NewDate(2025, 3, 2)).Started)
+		assert.True(t, enrollment.Position(program, NewDate(2025, 3, 17)).Finished)
+	})
+
+	t.Run("tracks adherence", func(t *testing.T) {
+		enrollment.Completions = []ProgramDayCompletion{{ProgramDayID: 1, WorkoutID: 50}}
+		adherence := enrollment.Adherence(program, NewDate(2025, 3, 10))
+		assert.Equal(t, 3, adherence.ScheduledDays)
+		assert.Equal(t, 2, adherence.DueDays)
+		assert.Equal(t, 1, adherence.CompletedDays)
+		assert.Equal(t, 50.0, adherence.Percent)
+
+		enrollment.Completions = append(enrollment.Completions, ProgramDayCompletion{ProgramDayID: 3, WorkoutID: 51})
+		adherence = enrollment.Adherence(program, NewDate(2025, 3, 10))
+		assert.Equal(t, 3, adherence.DueDays)
+		assert.Equal(t, 66.7, adherence.Percent)
+	})
+
+	t.Run("rejects days outside the program", func(t *testing.T) {
+		invalid := &Program{Name: "x", Weeks: 1, Days: []ProgramDay{{Week: 2, Day: 1}}}
+		assert.ErrorIs(t, invalid.Validate(), ErrInvalidProgram)
+	})
+}
+
+func TestCreateProgramUnknownExercise(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	templates := NewPostgresTemplateStore(db)
+	programs := NewPostgresProgramStore(db)
+	coach := createTestUser(t, db, "program-coach")
+
+	template, err := templates.CreateTemplate(&WorkoutTemplate{
+		UserID:  coach,
+		Name:    "Squat Day",
+		Entries: []TemplateEntry{{ExerciseName: "Back Squat", TargetSets: 5, TargetReps: IntPtr(5), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+
+	_, err = programs.CreateProgram(&Program{
+		UserID:       coach,
+		Name:         "5x5",
+		Weeks:        1,
+		Days:         []ProgramDay{{Week: 1, Day: 1, TemplateID: template.ID}},
+		Progressions: []ProgressionRule{{ExerciseID: IntPtr(-1), IncrementKg: 2.5}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidProgram)
+}
+
+func TestDeleteProgramAuthor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	users := NewPostgresUserStore(db)
+	templates := NewPostgresTemplateStore(db)
+	programs := NewPostgresProgramStore(db)
+	coach := createTestUser(t, db, "program-author")
+
+	template, err := templates.CreateTemplate(&WorkoutTemplate{
+		UserID:  coach,
+		Name:    "Squat Day",
+		Entries: []TemplateEntry{{ExerciseName: "Back Squat", TargetSets: 5, TargetReps: IntPtr(5), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+	program, err := programs.CreateProgram(&Program{
+		UserID: coach,
+		Name:   "5x5",
+		Weeks:  1,
+		Days:   []ProgramDay{{Week: 1, Day: 1, TemplateID: template.ID}},
+	})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, templates.DeleteTemplate(template.ID), ErrTemplateInUse)
+
+	require.NoError(t, users.DeleteUser(coach))
+	deleted, err := programs.GetProgramByID(program.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+}
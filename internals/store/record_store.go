@@ -0,0 +1,304 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RecordMaxWeight       = "max_weight"
+	RecordMaxRepsAtWeight = "max_reps_at_weight"
+	RecordE1RMEpley       = "e1rm_epley"
+	RecordE1RMBrzycki     = "e1rm_brzycki"
+	RecordLongestDuration = "longest_duration"
+	RecordMaxVolume       = "max_volume" // weight x reps of one exercise in one workout
+)
+
+// Estimated one-rep maxes get unreliable with high rep sets, so only sets up
+// to this many reps count towards them.
+const maxE1RMReps = 12
+
+// PersonalRecord is the best a user has done on an exercise for one record
+// type. Max reps are tracked per weight, so a user holds one such record for
+// every weight they have lifted.
+type PersonalRecord struct {
+	ID           int       `json:"id"`
+	ExerciseID   *int      `json:"exercise_id"`
+	ExerciseName string    `json:"exercise_name"`
+	RecordType   string    `json:"record_type"`
+	Value        float64   `json:"value"`
+	WeightKg     *float64  `json:"weight"`
+	Reps         *int      `json:"reps"`
+	WorkoutID    int       `json:"workout_id"`
+	AchievedAt   time.Time `json:"achieved_at"`
+}
+
+// key identifies the slot a record competes for.
+func (r PersonalRecord) key() string {
+	k := exerciseKey(r.ExerciseID, r.ExerciseName) + "|" + r.RecordType
+	if r.RecordType == RecordMaxRepsAtWeight {
+		k += fmt.Sprintf("|%.2f", derefFloat(r.WeightKg))
+	}
+	return k
+}
+
+// exerciseKey groups catalog entries by id and free-text entries by name.
+func exerciseKey(exerciseID *int, name string) string {
+	if exerciseID != nil {
+		return fmt.Sprintf("id:%d", *exerciseID)
+	}
+	return "name:" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// RecordSet is one logged set together with the workout it belongs to.
+type RecordSet struct {
+	WorkoutID    int
+	PerformedAt  time.Time
+	ExerciseID   *int
+	ExerciseName string
+	WorkoutSet
+}
+
+func EpleyE1RM(weight float64, reps int) float64 {
+	if reps == 1 {
+		return weight
+	}
+	return weight * (1 + float64(reps)/30)
+}
+
+func BrzyckiE1RM(weight float64, reps int) float64 {
+	return weight * 36 / (37 - float64(reps))
+}
+
+// ComputePersonalRecords returns the records held in the given history. Warm-up
+// sets never count. When a record is matched later the earlier workout keeps
+// it.
+func ComputePersonalRecords(sets []RecordSet) []PersonalRecord {
+	sets = append([]RecordSet(nil), sets...)
+	sort.SliceStable(sets, func(i, j int) bool {
+		if !sets[i].PerformedAt.Equal(sets[j].PerformedAt) {
+			return sets[i].PerformedAt.Before(sets[j].PerformedAt)
+		}
+		return sets[i].WorkoutID < sets[j].WorkoutID
+	})
+
+	best := map[string]*PersonalRecord{}
+	var order []string
+	consider := func(set RecordSet, recordType string, value float64, weight *float64, reps *int) {
+		record := PersonalRecord{
+			ExerciseID:   set.ExerciseID,
+			ExerciseName: set.ExerciseName,
+			RecordType:   recordType,
+			Value:        math.Round(value*100) / 100,
+			WeightKg:     weight,
+			Reps:         reps,
+			WorkoutID:    set.WorkoutID,
+			AchievedAt:   set.PerformedAt,
+		}
+		k := record.key()
+		current, ok := best[k]
+		if !ok {
+			order = append(order, k)
+		}
+		if !ok || record.Value > current.Value {
+			best[k] = &record
+		}
+	}
+
+	type sessionKey struct {
+		workoutID int
+		exercise  string
+	}
+	volumes := map[sessionKey]float64{}
+	var sessions []sessionKey
+	sessionSet := map[sessionKey]RecordSet{}
+
+	for _, set := range sets {
+		if set.SetType == SetTypeWarmup {
+			continue
+		}
+		weight := derefFloat(set.WeightKg)
+		if set.DurationSeconds != nil && *set.DurationSeconds > 0 {
+			consider(set, RecordLongestDuration, float64(*set.DurationSeconds), set.WeightKg, nil)
+		}
+		if set.Reps == nil || *set.Reps == 0 {
+			continue
+		}
+		reps := *set.Reps
+		consider(set, RecordMaxRepsAtWeight, float64(reps), &weight, set.Reps)
+		if weight == 0 {
+			continue
+		}
+		consider(set, RecordMaxWeight, weight, set.WeightKg, set.Reps)
+		if reps <= maxE1RMReps {
+			consider(set, RecordE1RMEpley, EpleyE1RM(weight, reps), set.WeightKg, set.Reps)
+			consider(set, RecordE1RMBrzycki, BrzyckiE1RM(weight, reps), set.WeightKg, set.Reps)
+		}
+		session := sessionKey{set.WorkoutID, exerciseKey(set.ExerciseID, set.ExerciseName)}
+		if _, ok := volumes[session]; !ok {
+			sessions = append(sessions, session)
+			sessionSet[session] = set
+		}
+		volumes[session] += weight * float64(reps)
+	}
+	for _, session := range sessions {
+		consider(sessionSet[session], RecordMaxVolume, volumes[session], nil, nil)
+	}
+
+	records := make([]PersonalRecord, 0, len(order))
+	for _, k := range order {
+		records = append(records, *best[k])
+	}
+	return records
+}
+
+type PostgresRecordStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRecordStore(db *sql.DB) *PostgresRecordStore {
+	return &PostgresRecordStore{
+		db: db,
+	}
+}
+
+type RecordStore interface {
+	ListPersonalRecords(userID int, exerciseID *int) ([]PersonalRecord, error)
+}
+
+const recordColumns = `id, exercise_id, exercise_name, record_type, value, weight, reps, workout_id, achieved_at`
+
+func scanRecord(row rowScanner, record *PersonalRecord) error {
+	return row.Scan(
+		&record.ID,
+		&record.ExerciseID,
+		&record.ExerciseName,
+		&record.RecordType,
+		&record.Value,
+		&record.WeightKg,
+		&record.Reps,
+		&record.WorkoutID,
+		&record.AchievedAt)
+}
+
+func (pg *PostgresRecordStore) ListPersonalRecords(userID int, exerciseID *int) ([]PersonalRecord, error) {
+	query := `
+		SELECT ` + recordColumns + `
+		FROM personal_records
+		WHERE user_id = $1 AND ($2::bigint IS NULL OR exercise_id = $2)
+		ORDER BY lower(exercise_name), record_type, weight DESC NULLS LAST
+	`
+	rows, err := pg.db.Query(query, userID, exerciseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query personal records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []PersonalRecord{}
+	for rows.Next() {
+		record := PersonalRecord{}
+		if err = scanRecord(rows, &record); err != nil {
+			return nil, fmt.Errorf("failed to scan personal record: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over personal records: %w", err)
+	}
+	return records, nil
+}
+
+// recomputePersonalRecords rebuilds the user's records for every exercise in
+// the given entries from their whole history. It runs after a workout is
+// saved or deleted so that records held by edited or removed workouts fall
+// back to the next best set. It returns the records set by workoutID that
+// the user did not hold before.
+func recomputePersonalRecords(tx *sql.Tx, userID int, workoutID int, entries ...[]WorkoutEntry) ([]PersonalRecord, error) {
+	var exerciseIDs []int64
+	var names []string
+	for _, list := range entries {
+		for _, entry := range list {
+			if entry.ExerciseID != nil {
+				exerciseIDs = append(exerciseIDs, int64(*entry.ExerciseID))
+			} else {
+				names = append(names, strings.ToLower(strings.TrimSpace(entry.ExerciseName)))
+			}
+		}
+	}
+	if len(exerciseIDs) == 0 && len(names) == 0 {
+		return []PersonalRecord{}, nil
+	}
+	scope := `user_id = $1 AND (exercise_id = ANY($2) OR (exercise_id IS NULL AND lower(exercise_name) = ANY($3)))`
+
+	previous := map[string]PersonalRecord{}
+	rows, err := tx.Query(`SELECT `+recordColumns+` FROM personal_records WHERE `+scope, userID, exerciseIDs, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query personal records: %w", err)
+	}
+	for rows.Next() {
+		record := PersonalRecord{}
+		if err = scanRecord(rows, &record); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan personal record: %w", err)
+		}
+		previous[record.key()] = record
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over personal records: %w", err)
+	}
+
+	var history []RecordSet
+	rows, err = tx.Query(`
+		SELECT w.id, w.performed_at, e.exercise_id, e.exercise_name, s.set_type, s.reps, s.duration_seconds, s.weight
+		FROM workout_entry_sets s
+		JOIN workout_entries e ON e.id = s.entry_id
+		JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = $1 AND (e.exercise_id = ANY($2) OR (e.exercise_id IS NULL AND lower(e.exercise_name) = ANY($3)))
+	`, userID, exerciseIDs, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query set history: %w", err)
+	}
+	for rows.Next() {
+		set := RecordSet{}
+		err = rows.Scan(&set.WorkoutID, &set.PerformedAt, &set.ExerciseID, &set.ExerciseName,
+			&set.SetType, &set.Reps, &set.DurationSeconds, &set.WeightKg)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan set history: %w", err)
+		}
+		history = append(history, set)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over set history: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM personal_records WHERE `+scope, userID, exerciseIDs, names)
+	if err != nil {
+		return nil, err
+	}
+
+	newRecords := []PersonalRecord{}
+	for _, record := range ComputePersonalRecords(history) {
+		err = tx.QueryRow(`
+			INSERT INTO personal_records (user_id, exercise_id, exercise_name, record_type, value, weight, reps,
+			workout_id, achieved_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`, userID, record.ExerciseID, record.ExerciseName, record.RecordType, record.Value, record.WeightKg,
+			record.Reps, record.WorkoutID, record.AchievedAt).Scan(&record.ID)
+		if err != nil {
+			return nil, err
+		}
+		old, held := previous[record.key()]
+		if record.WorkoutID == workoutID && (!held || old.WorkoutID != workoutID || old.Value != record.Value) {
+			newRecords = append(newRecords, record)
+		}
+	}
+	return newRecords, nil
+}
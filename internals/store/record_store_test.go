@@ -0,0 +1,66 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputePersonalRecords(t *testing.T) {
+	benchID := 7
+	day1 := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 2)
+	set := func(workoutID int, at time.Time, setType string, reps int, weight float64) RecordSet {
+		return RecordSet{
+			WorkoutID:    workoutID,
+			PerformedAt:  at,
+			ExerciseID:   &benchID,
+			ExerciseName: "Barbell Bench Press",
+			WorkoutSet:   WorkoutSet{SetType: setType, Reps: IntPtr(reps), WeightKg: Float64Ptr(weight)},
+		}
+	}
+	history := []RecordSet{
+		set(2, day2, SetTypeWorking, 3, 105),
+		set(1, day1, SetTypeWarmup, 5, 120), // warm-ups never count
+		set(1, day1, SetTypeWorking, 5, 100),
+		set(1, day1, SetTypeWorking, 5, 100),
+		set(2, day2, SetTypeWorking, 5, 100), // ties keep the earlier workout
+		{WorkoutID: 2, PerformedAt: day2, ExerciseName: "Plank",
+			WorkoutSet: WorkoutSet{SetType: SetTypeWorking, DurationSeconds: IntPtr(90)}},
+	}
+
+	byKey := map[string]PersonalRecord{}
+	for _, record := range ComputePersonalRecords(history) {
+		byKey[record.key()] = record
+	}
+	get := func(recordType string, weight *float64) PersonalRecord {
+		record, ok := byKey[PersonalRecord{ExerciseID: &benchID, RecordType: recordType, WeightKg: weight}.key()]
+		require.True(t, ok, "missing %s record", recordType)
+		return record
+	}
+
+	maxWeight := get(RecordMaxWeight, nil)
+	assert.Equal(t, 105.0, maxWeight.Value)
+	assert.Equal(t, 2, maxWeight.WorkoutID)
+
+	repsAt100 := get(RecordMaxRepsAtWeight, Float64Ptr(100))
+	assert.Equal(t, 5.0, repsAt100.Value)
+	assert.Equal(t, 1, repsAt100.WorkoutID)
+
+	// 100x5 gives 116.67 (Epley) and 112.5 (Brzycki), 105x3 gives 115.5 and 111.18.
+	epley := get(RecordE1RMEpley, nil)
+	assert.Equal(t, 116.67, epley.Value)
+	assert.Equal(t, 1, epley.WorkoutID)
+	brzycki := get(RecordE1RMBrzycki, nil)
+	assert.Equal(t, 112.5, brzycki.Value)
+
+	volume := get(RecordMaxVolume, nil)
+	assert.Equal(t, 1000.0, volume.Value)
+	assert.Equal(t, 1, volume.WorkoutID)
+
+	plank, ok := byKey[PersonalRecord{ExerciseName: "plank", RecordType: RecordLongestDuration}.key()]
+	require.True(t, ok)
+	assert.Equal(t, 90.0, plank.Value)
+}
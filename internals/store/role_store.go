@@ -0,0 +1,116 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+)
+
+const (
+	RoleUser  = "user"
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+const (
+	PermissionReadUsers       = "users:read"
+	PermissionAssignRoles     = "roles:assign"
+	PermissionReadAnyWorkouts = "workouts:read:any"
+	PermissionReadAuditLog    = "audit:read"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// Permissions are the permissions granted to a user through their role.
+type Permissions []string
+
+func (p Permissions) Include(permission string) bool {
+	return slices.Contains(p, permission)
+}
+
+// Scan reads the comma separated list produced by string_agg.
+func (p *Permissions) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return errors.New("permissions: unsupported source type")
+	}
+	*p = nil
+	if s != "" {
+		*p = strings.Split(s, ",")
+	}
+	return nil
+}
+
+type Role struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type PostgresRoleStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRoleStore(db *sql.DB) *PostgresRoleStore {
+	return &PostgresRoleStore{
+		db: db,
+	}
+}
+
+type RoleStore interface {
+	ListRoles() ([]Role, error)
+	// SetUserRole reports whether the user exists.
+	SetUserRole(userID int, role string) (bool, error)
+}
+
+func (s *PostgresRoleStore) ListRoles() ([]Role, error) {
+	query := `
+	SELECT r.name, r.description, COALESCE(string_agg(rp.permission, ',' ORDER BY rp.permission), '')
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role = r.name
+	GROUP BY r.name, r.description
+	ORDER BY r.name
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.Name, &role.Description, &role.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		if role.Permissions == nil {
+			role.Permissions = Permissions{}
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *PostgresRoleStore) SetUserRole(userID int, role string) (bool, error) {
+	query := `UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2`
+	result, err := s.db.Exec(query, role, userID)
+	if isForeignKeyViolation(err) {
+		return false, ErrUnknownRole
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionsScan(t *testing.T) {
+	var p Permissions
+	require.NoError(t, p.Scan("users:read,workouts:read:any"))
+	assert.Equal(t, Permissions{PermissionReadUsers, PermissionReadAnyWorkouts}, p)
+	assert.True(t, p.Include(PermissionReadAnyWorkouts))
+	assert.False(t, p.Include(PermissionAssignRoles))
+
+	require.NoError(t, p.Scan([]byte("")))
+	assert.Nil(t, p)
+	assert.False(t, p.Include(PermissionReadUsers))
+
+	assert.Error(t, p.Scan(42))
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"go_beginner/internals/tokens"
+)
+
+// SignedTokenStore issues access tokens that are signed instead of stored,
+// so that authenticating a request needs no database lookup. Everything
+// else, including refresh tokens and the session list, is kept in Postgres
+// like with PostgresTokenStore.
+//
+// Signed tokens cannot be deleted, so logging out adds a revocation. The
+// revocations are kept in memory and in the database, and WatchRevocations
+// picks up the ones made by other instances.
+type SignedTokenStore struct {
+	*PostgresTokenStore
+	signer      *tokens.Signer
+	revocations *tokens.RevocationList
+}
+
+func NewSignedTokenStore(db *sql.DB, signer *tokens.Signer) (*SignedTokenStore, error) {
+	s := &SignedTokenStore{
+		PostgresTokenStore: NewPostgresTokenStore(db),
+		signer:             signer,
+		revocations:        tokens.NewRevocationList(),
+	}
+	s.PostgresTokenStore.signAccess = s.signAccessToken
+	err := s.LoadRevocations()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// signAccessToken puts what the middleware needs to know about the user into
+// the token. Changes to the role take effect with the next access token.
+func (s *SignedTokenStore) signAccessToken(tx *sql.Tx, userID int, familyID int) (*tokens.Token, error) {
+	claims := tokens.Claims{UserID: userID, SessionID: familyID, Scope: tokens.ScopeAuth}
+	var permissions Permissions
+	err := tx.QueryRow(`
+		SELECT u.role, u.activated,
+			COALESCE((SELECT string_agg(rp.permission, ',') FROM role_permissions rp WHERE rp.role = u.role), '')
+		FROM users u
+		WHERE u.id = $1
+	`, userID).Scan(&claims.Role, &claims.Activated, &permissions)
+	if err != nil {
+		return nil, err
+	}
+	claims.Permissions = permissions
+	return s.signer.Sign(claims, tokens.AccessTokenTTL)
+}
+
+// VerifyAccessToken returns the user of a valid, unrevoked access token. Only
+// the fields carried by the token are set: ID, role, activated and
+// permissions.
+func (s *SignedTokenStore) VerifyAccessToken(token string) (*User, error) {
+	claims, err := s.signer.Verify(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Scope != tokens.ScopeAuth || s.revocations.Revoked(claims) {
+		return nil, tokens.ErrInvalidSignedToken
+	}
+	return &User{
+		ID:          claims.UserID,
+		Role:        claims.Role,
+		Activated:   claims.Activated,
+		Permissions: claims.Permissions,
+	}, nil
+}
+
+func (s *SignedTokenStore) revoke(r tokens.Revocation) error {
+	query := `
+	INSERT INTO token_revocations (session_id, user_id, before_session_id, expiry)
+	VALUES (NULLIF($1, 0), NULLIF($2, 0), NULLIF($3, 0), $4)
+	`
+	_, err := s.db.Exec(query, r.SessionID, r.UserID, r.BeforeSession, r.Expiry)
+	if err != nil {
+		return err
+	}
+	s.revocations.Add(r)
+	return nil
+}
+
+func (s *SignedTokenStore) revokeSession(sessionID int) error {
+	return s.revoke(tokens.Revocation{SessionID: sessionID, Expiry: time.Now().Add(tokens.AccessTokenTTL)})
+}
+
+// LoadRevocations reads the revocations that still matter from the database.
+func (s *SignedTokenStore) LoadRevocations() error {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(session_id, 0), COALESCE(user_id, 0), COALESCE(before_session_id, 0), expiry
+		FROM token_revocations
+		WHERE expiry > NOW()
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var revocations []tokens.Revocation
+	for rows.Next() {
+		var r tokens.Revocation
+		err := rows.Scan(&r.SessionID, &r.UserID, &r.BeforeSession, &r.Expiry)
+		if err != nil {
+			return err
+		}
+		revocations = append(revocations, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.revocations.Merge(revocations, time.Now())
+	return nil
+}
+
+// WatchRevocations reloads the revocations every interval and cleans up the
+// expired ones, for as long as the process runs.
+func (s *SignedTokenStore) WatchRevocations(interval time.Duration, logger *log.Logger) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := s.LoadRevocations(); err != nil {
+				logger.Printf("Error:: Loading token revocations: %v", err)
+			}
+			if _, err := s.db.Exec(`DELETE FROM token_revocations WHERE expiry <= NOW()`); err != nil {
+				logger.Printf("Error:: Deleting expired token revocations: %v", err)
+			}
+		}
+	}()
+}
+
+// DeleteToken revokes the session of a signed access token, and deletes the
+// rest of the session like PostgresTokenStore does.
+func (s *SignedTokenStore) DeleteToken(scope string, plainTokenText string) error {
+	if scope != tokens.ScopeAuth || !tokens.IsSigned(plainTokenText) {
+		return s.PostgresTokenStore.DeleteToken(scope, plainTokenText)
+	}
+	claims, err := s.signer.Verify(plainTokenText, time.Now())
+	if err != nil {
+		return nil // expired already
+	}
+	err = s.revokeSession(claims.SessionID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM tokens WHERE family_id = $1`, claims.SessionID)
+	return err
+}
+
+// DeleteAllTokensForUser also revokes every signed access token of the user
+// issued so far.
+func (s *SignedTokenStore) DeleteAllTokensForUser(userID int, scope string) error {
+	err := s.PostgresTokenStore.DeleteAllTokensForUser(userID, scope)
+	if err != nil || scope != tokens.ScopeAuth {
+		return err
+	}
+	// Sessions are numbered from the tokens sequence, so every session
+	// started from now on gets a higher number.
+	var next int
+	err = s.db.QueryRow(`SELECT nextval(pg_get_serial_sequence('tokens', 'id'))`).Scan(&next)
+	if err != nil {
+		return err
+	}
+	return s.revoke(tokens.Revocation{UserID: userID, BeforeSession: next, Expiry: time.Now().Add(tokens.AccessTokenTTL)})
+}
+
+func (s *SignedTokenStore) DeleteSession(userID int, sessionID int) (bool, error) {
+	found, err := s.PostgresTokenStore.DeleteSession(userID, sessionID)
+	if err != nil || !found {
+		return found, err
+	}
+	return true, s.revokeSession(sessionID)
+}
+
+// UseRefreshToken also revokes the access tokens of a session whose refresh
+// token was reused.
+func (s *SignedTokenStore) UseRefreshToken(plainTokenText string, ip string, userAgent string) (*TokenPair, error) {
+	tokenHash := sha256.Sum256([]byte(plainTokenText))
+	var familyID int
+	err := s.db.QueryRow(`SELECT family_id FROM tokens WHERE hash = $1 AND scope = $2`,
+		tokenHash[:], tokens.ScopeRefresh).Scan(&familyID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	pair, err := s.PostgresTokenStore.UseRefreshToken(plainTokenText, ip, userAgent)
+	if errors.Is(err, ErrRefreshTokenReused) && familyID != 0 {
+		if revokeErr := s.revokeSession(familyID); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	return pair, err
+}
+
+// ListSessions marks the session of a signed current token, which is not in
+// the tokens table.
+func (s *SignedTokenStore) ListSessions(userID int, currentToken string) ([]Session, error) {
+	sessions, err := s.PostgresTokenStore.ListSessions(userID, currentToken)
+	if err != nil || !tokens.IsSigned(currentToken) {
+		return sessions, err
+	}
+	claims, err := s.signer.Verify(currentToken, time.Now())
+	if err != nil {
+		return sessions, nil
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+	return sessions, nil
+}
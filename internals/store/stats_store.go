@@ -0,0 +1,347 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidBucket     = errors.New("invalid bucket: must be day, week or month")
+	ErrInvalidStatsRange = errors.New("invalid range")
+)
+
+// StatsBuckets are the supported sizes of a time series bucket. Weeks start
+// on StatsFilter.WeekStart.
+var StatsBuckets = []string{"day", "week", "month"}
+
+// maxStatsBuckets caps how many buckets a time series can have, about ten
+// years of weeks or months and a year of days.
+var maxStatsBuckets = map[string]int{"day": 366, "week": 520, "month": 120}
+
+// StatsFilter selects the workouts aggregated by the stats queries. Dates are
+// inclusive and evaluated in each workout's own timezone.
+type StatsFilter struct {
+	UserID int
+	From   *time.Time
+	To     *time.Time
+	Bucket string // day, week (default) or month
+	// WeekStart names the first day of week buckets, Monday when empty.
+	WeekStart string
+}
+
+func (f *StatsFilter) validate() error {
+	if f.Bucket == "" {
+		f.Bucket = "week"
+	}
+	limit, ok := maxStatsBuckets[f.Bucket]
+	if !ok {
+		return ErrInvalidBucket
+	}
+	if f.From == nil || f.To == nil {
+		return nil
+	}
+	if f.From.After(*f.To) {
+		return fmt.Errorf("%w: from must not be after to", ErrInvalidStatsRange)
+	}
+	if f.bucketCount() > limit {
+		return fmt.Errorf("%w: at most %d %ss fit between from and to", ErrInvalidStatsRange, limit, f.Bucket)
+	}
+	return nil
+}
+
+// SetDefaultRange ends an open range today and starts it as many buckets
+// before its end as a series can have.
+func (f *StatsFilter) SetDefaultRange(today time.Time) {
+	if f.To == nil {
+		f.To = &today
+	}
+	if f.From != nil {
+		return
+	}
+	bucket := f.Bucket
+	if bucket == "" {
+		bucket = "week"
+	}
+	back := maxStatsBuckets[bucket] - 1
+	var from time.Time
+	switch bucket {
+	case "day":
+		from = f.To.AddDate(0, 0, -back)
+	case "month":
+		from = time.Date(f.To.Year(), f.To.Month()-time.Month(back), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		from = f.To.AddDate(0, 0, -7*back)
+	}
+	f.From = &from
+}
+
+// bucketCount is how many buckets the series from From to To has.
+func (f *StatsFilter) bucketCount() int {
+	from, to := *f.From, *f.To
+	days := func() int { return int(to.Sub(from).Hours() / 24) }
+	switch f.Bucket {
+	case "month":
+		return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month()) + 1
+	case "week":
+		// Move from back to the first day of its week.
+		shift := ((int(from.Weekday())+6)%7 - daysAfterMonday(f.WeekStart) + 7) % 7
+		from = from.AddDate(0, 0, -shift)
+		return days()/7 + 1
+	default:
+		return days() + 1
+	}
+}
+
+// args are the placeholders shared by the stats queries: $1 user, $2 from,
+// $3 to, $4 bucket and $5 how many days after Monday weeks start (0 for the
+// other buckets, which date_trunc gets right).
+func (f *StatsFilter) args() []any {
+	args := []any{f.UserID, nil, nil, f.Bucket, 0}
+	if f.Bucket == "week" {
+		args[4] = daysAfterMonday(f.WeekStart)
+	}
+	if f.From != nil {
+		args[1] = f.From.Format(time.DateOnly)
+	}
+	if f.To != nil {
+		args[2] = f.To.Format(time.DateOnly)
+	}
+	return args
+}
+
+const statsScope = `w.user_id = $1
+	AND ($2::date IS NULL OR ` + workoutLocalDate + ` >= $2::date)
+	AND ($3::date IS NULL OR ` + workoutLocalDate + ` <= $3::date)`
+
+// statsBucket is the first day of a workout's bucket. date_trunc starts weeks
+// on Monday, so for other week starts the date is shifted back before
+// truncating and forward again after.
+const statsBucket = `(date_trunc($4, (` + workoutLocalDate + ` - $5::int)::timestamp) + $5::int * interval '1 day')::date`
+
+// statsSeries returns every bucket between the start of the range and its end
+// so that charts get explicit zeroes. Without a range it spans the buckets of
+// the aggregated rows in data, which needs a bucket column.
+const statsSeries = `
+	series AS (
+		SELECT generate_series(
+			date_trunc($4, (COALESCE($2::date, (SELECT MIN(bucket) FROM data)) - $5::int)::timestamp)
+				+ $5::int * interval '1 day',
+			COALESCE($3::date, (SELECT MAX(bucket) FROM data))::timestamp,
+			('1 ' || $4)::interval
+		)::date AS bucket
+	)`
+
+type WorkoutSummaryBucket struct {
+	Bucket          Date `json:"bucket"` // first day of the bucket
+	Workouts        int  `json:"workouts"`
+	DurationMinutes int  `json:"duration_minutes"`
+	CaloriesBurned  int  `json:"calories_burned"`
+}
+
+type VolumeBucket struct {
+	Bucket   Date    `json:"bucket"`
+	VolumeKg float64 `json:"volume"` // reps x weight of every non warm-up set
+	Sets     int     `json:"sets"`
+	Reps     int     `json:"reps"`
+}
+
+// ExerciseProgressPoint is the best performance on one exercise in a bucket.
+type ExerciseProgressPoint struct {
+	Bucket         Date     `json:"bucket"`
+	BestWeightKg   *float64 `json:"best_weight"`
+	BestSetReps    *int     `json:"best_set_reps"` // reps of the heaviest set
+	EstimatedOneRM *float64 `json:"e1rm"`          // Epley, from sets of up to 12 reps
+	VolumeKg       float64  `json:"volume"`
+	Sets           int      `json:"sets"`
+}
+
+type ExerciseFrequency struct {
+	Bucket        Date      `json:"bucket"`
+	ExerciseID    *int      `json:"exercise_id"`
+	ExerciseName  string    `json:"exercise_name"`
+	Workouts      int       `json:"workouts"`
+	Sets          int       `json:"sets"`
+	LastPerformed time.Time `json:"last_performed"`
+}
+
+type PostgresStatsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStatsStore(db *sql.DB) *PostgresStatsStore {
+	return &PostgresStatsStore{
+		db: db,
+	}
+}
+
+type StatsStore interface {
+	GetWorkoutSummary(filter StatsFilter) ([]WorkoutSummaryBucket, error)
+	GetVolume(filter StatsFilter, exerciseID *int) ([]VolumeBucket, error)
+	GetExerciseProgress(filter StatsFilter, exerciseID int) ([]ExerciseProgressPoint, error)
+	GetExerciseFrequency(filter StatsFilter) ([]ExerciseFrequency, error)
+}
+
+func (pg *PostgresStatsStore) GetWorkoutSummary(filter StatsFilter) ([]WorkoutSummaryBucket, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := `
+		WITH data AS (
+			SELECT ` + statsBucket + ` AS bucket, COUNT(*) AS workouts,
+				SUM(w.duration_minutes) AS duration_minutes, SUM(w.calories_burned) AS calories_burned
+			FROM workouts w
+			WHERE ` + statsScope + `
+			GROUP BY 1
+		), ` + statsSeries + `
+		SELECT s.bucket, COALESCE(d.workouts, 0), COALESCE(d.duration_minutes, 0), COALESCE(d.calories_burned, 0)
+		FROM series s
+		LEFT JOIN data d ON d.bucket = s.bucket
+		ORDER BY s.bucket
+	`
+	rows, err := pg.db.Query(query, filter.args()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workout summary: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []WorkoutSummaryBucket{}
+	for rows.Next() {
+		bucket := WorkoutSummaryBucket{}
+		err = rows.Scan(&bucket.Bucket, &bucket.Workouts, &bucket.DurationMinutes, &bucket.CaloriesBurned)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workout summary: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over workout summary: %w", err)
+	}
+	return buckets, nil
+}
+
+func (pg *PostgresStatsStore) GetVolume(filter StatsFilter, exerciseID *int) ([]VolumeBucket, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := `
+		WITH data AS (
+			SELECT ` + statsBucket + ` AS bucket,
+				SUM(COALESCE(s.reps, 0) * COALESCE(s.weight, 0)) AS volume,
+				COUNT(s.id) AS sets, SUM(COALESCE(s.reps, 0)) AS reps
+			FROM workouts w
+			JOIN workout_entries e ON e.workout_id = w.id
+			JOIN workout_entry_sets s ON s.entry_id = e.id
+			WHERE ` + statsScope + ` AND s.set_type <> 'warmup'
+				AND ($6::bigint IS NULL OR e.exercise_id = $6)
+			GROUP BY 1
+		), ` + statsSeries + `
+		SELECT s.bucket, COALESCE(d.volume, 0), COALESCE(d.sets, 0), COALESCE(d.reps, 0)
+		FROM series s
+		LEFT JOIN data d ON d.bucket = s.bucket
+		ORDER BY s.bucket
+	`
+	rows, err := pg.db.Query(query, append(filter.args(), exerciseID)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query volume: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []VolumeBucket{}
+	for rows.Next() {
+		bucket := VolumeBucket{}
+		err = rows.Scan(&bucket.Bucket, &bucket.VolumeKg, &bucket.Sets, &bucket.Reps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan volume: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over volume: %w", err)
+	}
+	return buckets, nil
+}
+
+// GetExerciseProgress returns one point per bucket in which the exercise was
+// performed. Buckets without the exercise are left out rather than zeroed, a
+// missing best set is not a zero kg lift.
+func (pg *PostgresStatsStore) GetExerciseProgress(filter StatsFilter, exerciseID int) ([]ExerciseProgressPoint, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT ` + statsBucket + ` AS bucket,
+			MAX(s.weight),
+			(array_agg(s.reps ORDER BY s.weight DESC NULLS LAST, s.reps DESC NULLS LAST))[1],
+			ROUND(MAX(CASE WHEN s.reps = 1 THEN s.weight ELSE s.weight * (1 + s.reps / 30.0) END)
+				FILTER (WHERE s.reps BETWEEN 1 AND ` + fmt.Sprint(maxE1RMReps) + `), 2),
+			SUM(COALESCE(s.reps, 0) * COALESCE(s.weight, 0)),
+			COUNT(s.id)
+		FROM workouts w
+		JOIN workout_entries e ON e.workout_id = w.id
+		JOIN workout_entry_sets s ON s.entry_id = e.id
+		WHERE ` + statsScope + ` AND s.set_type <> 'warmup' AND e.exercise_id = $6
+		GROUP BY 1
+		ORDER BY 1
+	`
+	rows, err := pg.db.Query(query, append(filter.args(), exerciseID)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exercise progress: %w", err)
+	}
+	defer rows.Close()
+
+	points := []ExerciseProgressPoint{}
+	for rows.Next() {
+		point := ExerciseProgressPoint{}
+		err = rows.Scan(&point.Bucket, &point.BestWeightKg, &point.BestSetReps, &point.EstimatedOneRM,
+			&point.VolumeKg, &point.Sets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exercise progress: %w", err)
+		}
+		points = append(points, point)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over exercise progress: %w", err)
+	}
+	return points, nil
+}
+
+// GetExerciseFrequency counts how often each exercise was performed per
+// bucket, most frequent first within a bucket.
+func (pg *PostgresStatsStore) GetExerciseFrequency(filter StatsFilter) ([]ExerciseFrequency, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT ` + statsBucket + ` AS bucket, e.exercise_id, MAX(COALESCE(x.name, e.exercise_name)),
+			COUNT(DISTINCT w.id), COUNT(s.id), MAX(w.performed_at)
+		FROM workouts w
+		JOIN workout_entries e ON e.workout_id = w.id
+		LEFT JOIN exercises x ON x.id = e.exercise_id
+		LEFT JOIN workout_entry_sets s ON s.entry_id = e.id AND s.set_type <> 'warmup'
+		WHERE ` + statsScope + `
+		GROUP BY 1, e.exercise_id, CASE WHEN e.exercise_id IS NULL THEN lower(e.exercise_name) END
+		ORDER BY 1, 4 DESC, 3
+	`
+	rows, err := pg.db.Query(query, filter.args()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exercise frequency: %w", err)
+	}
+	defer rows.Close()
+
+	frequencies := []ExerciseFrequency{}
+	for rows.Next() {
+		frequency := ExerciseFrequency{}
+		err = rows.Scan(&frequency.Bucket, &frequency.ExerciseID, &frequency.ExerciseName, &frequency.Workouts, &frequency.Sets,
+			&frequency.LastPerformed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exercise frequency: %w", err)
+		}
+		frequencies = append(frequencies, frequency)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over exercise frequency: %w", err)
+	}
+	return frequencies, nil
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsSummaryAndVolume(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	workoutStore := NewPostgresWorkoutStore(db)
+	statsStore := NewPostgresStatsStore(db)
+	owner := createTestUser(t, db, "stats-owner")
+
+	// Monday 3rd and Wednesday 5th of March, then nothing until Monday 17th.
+	for _, day := range []int{3, 5, 17} {
+		_, err := workoutStore.CreateWorkout(&Workout{
+			Title:           "Push",
+			DurationMinutes: 60,
+			CaloriesBurned:  400,
+			UserId:          owner,
+			PerformedAt:     time.Date(2025, 3, day, 18, 0, 0, 0, time.UTC),
+			Entries: []WorkoutEntry{
+				{ExerciseName: "Bench Press", SetDetails: []WorkoutSet{
+					{SetType: SetTypeWarmup, Reps: IntPtr(10), WeightKg: Float64Ptr(40)},
+					{Reps: IntPtr(5), WeightKg: Float64Ptr(100)},
+					{Reps: IntPtr(5), WeightKg: Float64Ptr(100)},
+				}},
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	summary, err := statsStore.GetWorkoutSummary(StatsFilter{UserID: owner, Bucket: "week"})
+	require.NoError(t, err)
+	require.Len(t, summary, 3, "the empty week in between is filled in")
+	assert.Equal(t, "2025-03-03", summary[0].Bucket.String())
+	assert.Equal(t, 2, summary[0].Workouts)
+	assert.Equal(t, 120, summary[0].DurationMinutes)
+	assert.Equal(t, 0, summary[1].Workouts)
+	assert.Equal(t, 1, summary[2].Workouts)
+
+	volume, err := statsStore.GetVolume(StatsFilter{UserID: owner, Bucket: "month"}, nil)
+	require.NoError(t, err)
+	require.Len(t, volume, 1)
+	assert.Equal(t, 3000.0, volume[0].VolumeKg)
+	assert.Equal(t, 6, volume[0].Sets)
+
+	_, err = statsStore.GetWorkoutSummary(StatsFilter{UserID: owner, Bucket: "year"})
+	assert.ErrorIs(t, err, ErrInvalidBucket)
+}
+
+func TestStatsWeekStart(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	workoutStore := NewPostgresWorkoutStore(db)
+	statsStore := NewPostgresStatsStore(db)
+	owner := createTestUser(t, db, "week-start-owner")
+
+	// Saturday 1st, Sunday 2nd and Wednesday 5th of March, then Sunday 16th.
+	for _, day := range []int{1, 2, 5, 16} {
+		_, err := workoutStore.CreateWorkout(&Workout{
+			Title:           "Run",
+			DurationMinutes: 30,
+			UserId:          owner,
+			PerformedAt:     time.Date(2025, 3, day, 18, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("buckets start on sunday", func(t *testing.T) {
+		summary, err := statsStore.GetWorkoutSummary(StatsFilter{UserID: owner, Bucket: "week", WeekStart: "sunday"})
+		require.NoError(t, err)
+		var buckets []string
+		var workouts []int
+		for _, bucket := range summary {
+			assert.Equal(t, time.Sunday, bucket.Bucket.Weekday(), bucket.Bucket.String())
+			buckets = append(buckets, bucket.Bucket.String())
+			workouts = append(workouts, bucket.Workouts)
+		}
+		assert.Equal(t, []string{"2025-02-23", "2025-03-02", "2025-03-09", "2025-03-16"}, buckets)
+		assert.Equal(t, []int{1, 2, 0, 1}, workouts, "the series lines up with the data")
+	})
+
+	t.Run("the series of a range starts on the week of from", func(t *testing.T) {
+		from := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)
+		summary, err := statsStore.GetWorkoutSummary(StatsFilter{UserID: owner, From: &from, To: &to, Bucket: "week", WeekStart: "sunday"})
+		require.NoError(t, err)
+		require.Len(t, summary, 3)
+		assert.Equal(t, "2025-03-02", summary[0].Bucket.String())
+		assert.Equal(t, 1, summary[0].Workouts, "only the wednesday is in range")
+		assert.Equal(t, 0, summary[1].Workouts)
+		assert.Equal(t, 1, summary[2].Workouts)
+	})
+
+	t.Run("the week start only applies to weeks", func(t *testing.T) {
+		summary, err := statsStore.GetWorkoutSummary(StatsFilter{UserID: owner, Bucket: "month", WeekStart: "sunday"})
+		require.NoError(t, err)
+		require.Len(t, summary, 1)
+		assert.Equal(t, "2025-03-01", summary[0].Bucket.String())
+	})
+}
+
+func TestStatsFilterRange(t *testing.T) {
+	day := func(year int, month time.Month, d int) *time.Time {
+		date := time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+
+	tests := []struct {
+		name    string
+		filter  StatsFilter
+		wantErr error
+	}{
+		{name: "open range", filter: StatsFilter{}},
+		{name: "one day", filter: StatsFilter{From: day(2026, time.March, 2), To: day(2026, time.March, 2), Bucket: "day"}},
+		{name: "from after to", filter: StatsFilter{From: day(2026, time.March, 3), To: day(2026, time.March, 2)}, wantErr: ErrInvalidStatsRange},
+		{name: "366 days", filter: StatsFilter{From: day(2024, time.January, 1), To: day(2024, time.December, 31), Bucket: "day"}},
+		{name: "367 days", filter: StatsFilter{From: day(2024, time.January, 1), To: day(2025, time.January, 1), Bucket: "day"}, wantErr: ErrInvalidStatsRange},
+		// 2016-03-07 is a Monday, 520 Monday weeks end on 2026-02-22.
+		{name: "520 weeks", filter: StatsFilter{From: day(2016, time.March, 7), To: day(2026, time.February, 22)}},
+		{name: "521 weeks", filter: StatsFilter{From: day(2016, time.March, 7), To: day(2026, time.February, 23)}, wantErr: ErrInvalidStatsRange},
+		// With Sunday weeks, 2016-03-07 is in the week of 2016-03-06.
+		{name: "521 Sunday weeks", filter: StatsFilter{From: day(2016, time.March, 7), To: day(2026, time.February, 22), WeekStart: "sunday"}, wantErr: ErrInvalidStatsRange},
+		{name: "120 months", filter: StatsFilter{From: day(2016, time.March, 31), To: day(2026, time.February, 1), Bucket: "month"}},
+		{name: "121 months", filter: StatsFilter{From: day(2016, time.March, 31), To: day(2026, time.March, 1), Bucket: "month"}, wantErr: ErrInvalidStatsRange},
+		{name: "unknown bucket", filter: StatsFilter{Bucket: "year"}, wantErr: ErrInvalidBucket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.validate()
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	today := *day(2026, time.March, 31)
+	for _, bucket := range StatsBuckets {
+		t.Run("default range of "+bucket, func(t *testing.T) {
+			filter := StatsFilter{Bucket: bucket, WeekStart: "sunday"}
+			filter.SetDefaultRange(today)
+			require.NotNil(t, filter.From)
+			assert.Equal(t, today, *filter.To)
+			assert.NoError(t, filter.validate())
+			assert.Equal(t, maxStatsBuckets[bucket], filter.bucketCount())
+		})
+	}
+
+	from := day(2026, time.January, 1)
+	filter := StatsFilter{From: from}
+	filter.SetDefaultRange(today)
+	assert.Equal(t, from, filter.From, "an explicit start is kept")
+	assert.Equal(t, today, *filter.To)
+}
@@ -0,0 +1,426 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTemplate = errors.New("invalid template")
+	ErrTemplateInUse   = errors.New("template is used by a program")
+)
+
+// WorkoutTemplate is a reusable routine such as "Push Day A": a named list of
+// planned entries with their targets.
+type WorkoutTemplate struct {
+	ID          int             `json:"id"`
+	UserID      int             `json:"user_id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Entries     []TemplateEntry `json:"entries"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type TemplateEntry struct {
+	ID                    int      `json:"id"`
+	ExerciseID            *int     `json:"exercise_id"`
+	ExerciseName          string   `json:"exercise_name"`
+	TargetSets            int      `json:"target_sets"`
+	TargetReps            *int     `json:"target_reps"`
+	TargetDurationSeconds *int     `json:"target_duration_seconds"`
+	TargetWeightKg        *float64 `json:"target_weight"` // in kilograms
+	Notes                 *string  `json:"notes"`
+	OrderIndex            int      `json:"order_index"`
+}
+
+func (t *WorkoutTemplate) OwnerID() int { return t.UserID }
+
+func (t *WorkoutTemplate) Validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTemplate)
+	}
+	if len(t.Name) > 100 {
+		return fmt.Errorf("%w: name must be at most 100 characters", ErrInvalidTemplate)
+	}
+	for i, entry := range t.Entries {
+		if strings.TrimSpace(entry.ExerciseName) == "" && entry.ExerciseID == nil {
+			return fmt.Errorf("%w: entry %d: exercise_name or exercise_id is required", ErrInvalidTemplate, i+1)
+		}
+		if entry.TargetSets < 1 {
+			return fmt.Errorf("%w: entry %d: target_sets must be at least 1", ErrInvalidTemplate, i+1)
+		}
+		if (entry.TargetReps == nil) == (entry.TargetDurationSeconds == nil) {
+			return fmt.Errorf("%w: entry %d: either target_reps or target_duration_seconds is required", ErrInvalidTemplate, i+1)
+		}
+	}
+	return nil
+}
+
+type PostgresTemplateStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTemplateStore(db *sql.DB) *PostgresTemplateStore {
+	return &PostgresTemplateStore{
+		db: db,
+	}
+}
+
+type TemplateStore interface {
+	CreateTemplate(*WorkoutTemplate) (*WorkoutTemplate, error)
+	GetTemplateByID(id int) (*WorkoutTemplate, error)
+	ListTemplates(userID int) ([]WorkoutTemplate, error)
+	UpdateTemplate(*WorkoutTemplate) error
+	DeleteTemplate(id int) error
+}
+
+func (pg *PostgresTemplateStore) CreateTemplate(template *WorkoutTemplate) (*WorkoutTemplate, error) {
+	if err := template.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO workout_templates (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, template.UserID, template.Name, template.Description).Scan(
+		&template.ID,
+		&template.CreatedAt,
+		&template.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTemplateEntries(tx, template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func insertTemplateEntries(tx *sql.Tx, template *WorkoutTemplate) error {
+	query := `
+		INSERT INTO workout_template_entries (template_id, exercise_id, exercise_name, target_sets,
+		target_reps, target_duration_seconds, target_weight, notes, order_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	for i := range template.Entries {
+		entry := &template.Entries[i]
+		exerciseID, exerciseName, err := linkExercise(tx, entry.ExerciseID, entry.ExerciseName, template.UserID)
+		if errors.Is(err, ErrInvalidWorkout) {
+			return fmt.Errorf("%w: unknown exercise_id %d", ErrInvalidTemplate, *entry.ExerciseID)
+		}
+		if err != nil {
+			return err
+		}
+		entry.ExerciseID, entry.ExerciseName = exerciseID, exerciseName
+		err = tx.QueryRow(query, template.ID, entry.ExerciseID, entry.ExerciseName, entry.TargetSets,
+			entry.TargetReps, entry.TargetDurationSeconds, entry.TargetWeightKg, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pg *PostgresTemplateStore) GetTemplateByID(id int) (*WorkoutTemplate, error) {
+	query := `
+		SELECT id, user_id, name, description, created_at, updated_at
+		FROM workout_templates
+		WHERE id = $1
+	`
+	template := WorkoutTemplate{}
+	err := pg.db.QueryRow(query, id).Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Name,
+		&template.Description,
+		&template.CreatedAt,
+		&template.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []WorkoutTemplate{template}
+	err = pg.loadTemplateEntries(templates)
+	if err != nil {
+		return nil, err
+	}
+	return &templates[0], nil
+}
+
+func (pg *PostgresTemplateStore) ListTemplates(userID int) ([]WorkoutTemplate, error) {
+	query := `
+		SELECT id, user_id, name, description, created_at, updated_at
+		FROM workout_templates
+		WHERE user_id = $1
+		ORDER BY name, id
+	`
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []WorkoutTemplate{}
+	for rows.Next() {
+		template := WorkoutTemplate{}
+		err = rows.Scan(
+			&template.ID,
+			&template.UserID,
+			&template.Name,
+			&template.Description,
+			&template.CreatedAt,
+			&template.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over templates: %w", err)
+	}
+
+	err = pg.loadTemplateEntries(templates)
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (pg *PostgresTemplateStore) loadTemplateEntries(templates []WorkoutTemplate) error {
+	if len(templates) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(templates))
+	byID := make(map[int]*WorkoutTemplate, len(templates))
+	for i := range templates {
+		ids[i] = int64(templates[i].ID)
+		byID[templates[i].ID] = &templates[i]
+		templates[i].Entries = []TemplateEntry{}
+	}
+
+	query := `
+		SELECT template_id, id, exercise_id, exercise_name, target_sets, target_reps,
+		target_duration_seconds, target_weight, notes, order_index
+		FROM workout_template_entries
+		WHERE template_id = ANY($1)
+		ORDER BY template_id, order_index, id
+	`
+	rows, err := pg.db.Query(query, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query template entries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var templateID int
+		entry := TemplateEntry{}
+		err = rows.Scan(
+			&templateID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.TargetSets,
+			&entry.TargetReps,
+			&entry.TargetDurationSeconds,
+			&entry.TargetWeightKg,
+			&entry.Notes,
+			&entry.OrderIndex)
+		if err != nil {
+			return fmt.Errorf("failed to scan template entry: %w", err)
+		}
+		template := byID[templateID]
+		template.Entries = append(template.Entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over template entries: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresTemplateStore) UpdateTemplate(template *WorkoutTemplate) error {
+	if err := template.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE workout_templates
+		SET name = $1, description = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING updated_at
+	`
+	err = tx.QueryRow(query, template.Name, template.Description, template.ID).Scan(&template.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("template with ID %d not found", template.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_template_entries WHERE template_id = $1`, template.ID)
+	if err != nil {
+		return err
+	}
+	err = insertTemplateEntries(tx, template)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTemplate deletes a template that no program schedules. The foreign key
+// from program_days cascades so that deleting a user removes both their
+// programs and templates, which is why the check is done here. The row lock
+// waits for a CreateProgram that is scheduling the template.
+func (pg *PostgresTemplateStore) DeleteTemplate(id int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM program_days WHERE template_id = t.id)
+		FROM workout_templates t
+		WHERE t.id = $1
+		FOR UPDATE OF t
+	`, id).Scan(&inUse)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("template with ID %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrTemplateInUse
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_templates WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewTemplateFromWorkout turns a logged workout into a template of userID,
+// who may be a coach copying an athlete's workout. The targets are taken from
+// each entry's top set. Exercises of a copied workout are resolved by name
+// again, since the athlete's custom exercises are not the owner's.
+func NewTemplateFromWorkout(workout *Workout, userID int, name string) *WorkoutTemplate {
+	if strings.TrimSpace(name) == "" {
+		name = workout.Title
+	}
+	template := &WorkoutTemplate{
+		UserID:      userID,
+		Name:        name,
+		Description: workout.Description,
+		Entries:     make([]TemplateEntry, 0, len(workout.Entries)),
+	}
+	for _, entry := range workout.Entries {
+		exerciseID := entry.ExerciseID
+		if userID != workout.UserId {
+			exerciseID = nil
+		}
+		template.Entries = append(template.Entries, TemplateEntry{
+			ExerciseID:            exerciseID,
+			ExerciseName:          entry.ExerciseName,
+			TargetSets:            max(entry.Sets, 1),
+			TargetReps:            entry.Reps,
+			TargetDurationSeconds: entry.DurationSeconds,
+			TargetWeightKg:        entry.WeightKg,
+			Notes:                 entry.Notes,
+			OrderIndex:            entry.OrderIndex,
+		})
+	}
+	return template
+}
+
+// NewWorkoutFromTemplate starts a workout from a template. Entries that were
+// part of the last workout started from the same template are pre-filled
+// with the sets performed back then, the others with the template targets.
+func NewWorkoutFromTemplate(template *WorkoutTemplate, last *Workout, startedAt time.Time) *Workout {
+	workout := &Workout{
+		Title:       template.Name,
+		Description: template.Description,
+		UserId:      template.UserID,
+		TemplateID:  &template.ID,
+		StartedAt:   &startedAt,
+		PerformedAt: startedAt,
+		Entries:     make([]WorkoutEntry, 0, len(template.Entries)),
+	}
+
+	var previous []WorkoutEntry
+	if last != nil {
+		previous = slices.Clone(last.Entries)
+	}
+	for _, planned := range template.Entries {
+		entry := WorkoutEntry{
+			ExerciseID:   planned.ExerciseID,
+			ExerciseName: planned.ExerciseName,
+			Notes:        planned.Notes,
+			OrderIndex:   planned.OrderIndex,
+		}
+		if i := slices.IndexFunc(previous, planned.matches); i >= 0 {
+			for _, set := range previous[i].SetDetails {
+				entry.SetDetails = append(entry.SetDetails, WorkoutSet{
+					SetType:         set.SetType,
+					Reps:            set.Reps,
+					DurationSeconds: set.DurationSeconds,
+					WeightKg:        set.WeightKg,
+					DistanceMeters:  set.DistanceMeters,
+					RestSeconds:     set.RestSeconds,
+				})
+			}
+			previous = slices.Delete(previous, i, i+1)
+		}
+		if len(entry.SetDetails) == 0 {
+			for range planned.TargetSets {
+				entry.SetDetails = append(entry.SetDetails, WorkoutSet{
+					SetType:         SetTypeWorking,
+					Reps:            planned.TargetReps,
+					DurationSeconds: planned.TargetDurationSeconds,
+					WeightKg:        planned.TargetWeightKg,
+				})
+			}
+		}
+		workout.Entries = append(workout.Entries, entry)
+	}
+	return workout
+}
+
+func (e TemplateEntry) matches(logged WorkoutEntry) bool {
+	if e.ExerciseID != nil && logged.ExerciseID != nil {
+		return *e.ExerciseID == *logged.ExerciseID
+	}
+	return strings.EqualFold(strings.TrimSpace(e.ExerciseName), strings.TrimSpace(logged.ExerciseName))
+}
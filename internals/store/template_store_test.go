@@ -0,0 +1,132 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWorkoutFromTemplate(t *testing.T) {
+	benchID := 7
+	template := &WorkoutTemplate{
+		ID:     3,
+		UserID: 1,
+		Name:   "Push Day A",
+		Entries: []TemplateEntry{
+			{ExerciseID: &benchID, ExerciseName: "Barbell Bench Press", TargetSets: 3, TargetReps: IntPtr(5), TargetWeightKg: Float64Ptr(100), OrderIndex: 1},
+			{ExerciseName: "Lateral Raise", TargetSets: 2, TargetReps: IntPtr(12), TargetWeightKg: Float64Ptr(10), OrderIndex: 2},
+		},
+	}
+	startedAt := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("uses the targets without history", func(t *testing.T) {
+		workout := NewWorkoutFromTemplate(template, nil, startedAt)
+		assert.Equal(t, "Push Day A", workout.Title)
+		assert.Equal(t, &template.ID, workout.TemplateID)
+		require.Len(t, workout.Entries, 2)
+		require.Len(t, workout.Entries[0].SetDetails, 3)
+		assert.Equal(t, Float64Ptr(100), workout.Entries[0].SetDetails[0].WeightKg)
+	})
+
+	t.Run("pre-fills the weights from the last session", func(t *testing.T) {
+		last := &Workout{Entries: []WorkoutEntry{
+			{ExerciseName: "lateral raise", SetDetails: []WorkoutSet{
+				{SetType: SetTypeWorking, Reps: IntPtr(12), WeightKg: Float64Ptr(12)},
+			}},
+			{ExerciseID: &benchID, ExerciseName: "Bench", SetDetails: []WorkoutSet{
+				{SetType: SetTypeWarmup, Reps: IntPtr(8), WeightKg: Float64Ptr(60)},
+				{SetType: SetTypeWorking, Reps: IntPtr(5), WeightKg: Float64Ptr(102.5)},
+			}},
+		}}
+		workout := NewWorkoutFromTemplate(template, last, startedAt)
+		require.Len(t, workout.Entries, 2)
+		require.Len(t, workout.Entries[0].SetDetails, 2)
+		assert.Equal(t, SetTypeWarmup, workout.Entries[0].SetDetails[0].SetType)
+		assert.Equal(t, Float64Ptr(102.5), workout.Entries[0].SetDetails[1].WeightKg)
+		assert.Equal(t, Float64Ptr(12), workout.Entries[1].SetDetails[0].WeightKg)
+		assert.Equal(t, "Barbell Bench Press", workout.Entries[0].ExerciseName)
+	})
+}
+
+func TestCreateTemplateUnknownExercise(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	templates := NewPostgresTemplateStore(db)
+	userID := createTestUser(t, db, "template-owner")
+
+	_, err = templates.CreateTemplate(&WorkoutTemplate{
+		UserID: userID,
+		Name:   "Push Day A",
+		Entries: []TemplateEntry{
+			{ExerciseID: IntPtr(-1), TargetSets: 3, TargetReps: IntPtr(5), OrderIndex: 1},
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+
+	list, err := templates.ListTemplates(userID)
+	require.NoError(t, err)
+	assert.Empty(t, list, "the transaction is rolled back")
+}
+
+func TestNewTemplateFromWorkout(t *testing.T) {
+	benchID := 7
+	workout := &Workout{
+		UserId: 2,
+		Title:  "Push Day",
+		Entries: []WorkoutEntry{
+			{ExerciseID: &benchID, ExerciseName: "Bench", Sets: 3, Reps: IntPtr(5), WeightKg: Float64Ptr(100), OrderIndex: 1},
+		},
+	}
+
+	own := NewTemplateFromWorkout(workout, 2, "")
+	assert.Equal(t, 2, own.UserID)
+	assert.Equal(t, "Push Day", own.Name)
+	assert.Equal(t, &benchID, own.Entries[0].ExerciseID)
+
+	copied := NewTemplateFromWorkout(workout, 5, "Athlete's push")
+	assert.Equal(t, 5, copied.UserID, "the template belongs to the coach")
+	assert.Equal(t, "Athlete's push", copied.Name)
+	assert.Nil(t, copied.Entries[0].ExerciseID, "resolved again by name for the coach")
+	assert.Equal(t, "Bench", copied.Entries[0].ExerciseName)
+}
+
+func TestCopyWorkoutOfAnotherUser(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	workouts := NewPostgresWorkoutStore(db)
+	templates := NewPostgresTemplateStore(db)
+	exercises := NewPostgresExerciseStore(db)
+	athlete := createTestUser(t, db, "template-athlete")
+	coach := createTestUser(t, db, "template-coach")
+
+	custom, err := exercises.CreateExercise(&Exercise{Name: "Spoto Press", PrimaryMuscles: []string{"chest"}, UserID: &athlete})
+	require.NoError(t, err)
+	workout, err := workouts.CreateWorkout(&Workout{
+		Title:  "Push",
+		UserId: athlete,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Bench", Sets: 3, Reps: IntPtr(5), OrderIndex: 1},
+			{ExerciseID: &custom.ID, Sets: 3, Reps: IntPtr(5), OrderIndex: 2},
+		},
+	})
+	require.NoError(t, err)
+
+	template, err := templates.CreateTemplate(NewTemplateFromWorkout(workout, coach, ""))
+	require.NoError(t, err)
+	assert.Equal(t, coach, template.UserID)
+	require.Len(t, template.Entries, 2)
+	assert.NotNil(t, template.Entries[0].ExerciseID, "library exercises resolve for the coach")
+	assert.Nil(t, template.Entries[1].ExerciseID, "the athlete's custom exercise is not linked")
+
+	own, err := templates.ListTemplates(athlete)
+	require.NoError(t, err)
+	assert.Empty(t, own, "nothing is written into the athlete's account")
+}
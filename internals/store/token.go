@@ -1,13 +1,20 @@
 package store
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"errors"
+	"fmt"
 	"go_beginner/internals/tokens"
+	"strings"
 	"time"
 )
 
 type PostgresTokenStore struct {
 	db *sql.DB
+	// signAccess, when set, issues access tokens that are signed instead of
+	// stored. See SignedTokenStore.
+	signAccess func(tx *sql.Tx, userID int, familyID int) (*tokens.Token, error)
 }
 
 func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
@@ -16,15 +23,52 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 	}
 }
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
 type TokenStore interface {
 	Insert(token *tokens.Token) error 
 	CrateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
+	CreateTokenPair(userID int, ip string, userAgent string) (*TokenPair, error)
+	UseRefreshToken(plainTokenText string, ip string, userAgent string) (*TokenPair, error)
+	DeleteToken(scope string, plainTokenText string) error
+	ConsumeToken(scope string, plainTokenText string) (int, error)
 	DeleteAllTokensForUser(userID int, scope string) error
+	ListSessions(userID int, currentToken string) ([]Session, error)
+	DeleteSession(userID int, sessionID int) (bool, error)
+}
+
+// TokenPair is a short-lived access token and the refresh token to renew it.
+type TokenPair struct {
+	Access  *tokens.Token `json:"token"`
+	Refresh *tokens.Token `json:"refresh_token"`
+}
+
+// Session is one login, i.e. a token family, as shown to its owner.
+type Session struct {
+	ID         int        `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"` // the session of this request
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
 }
 
 func (s *PostgresTokenStore) Insert(token *tokens.Token) error {
-	query := `INSERT INTO tokens ( hash, user_id, expiry, scope) VALUES ($1, $2, $3, $4)`
-	_, err := s.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	return insertToken(s.db, token)
+}
+
+func insertToken(db execer, token *tokens.Token) error {
+	query := `INSERT INTO tokens ( hash, user_id, expiry, scope, ip, user_agent, family_id)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))`
+	_, err := db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.FamilyID)
 	return err
 }
 
@@ -45,3 +89,203 @@ func (s *PostgresTokenStore) DeleteAllTokensForUser(userID int, scope string) er
 	_, err := s.db.Exec(query, userID, scope)
 	return err
 }
+
+// maxUserAgentLength matches the tokens.user_agent column.
+const maxUserAgentLength = 512
+
+// CreateTokenPair starts a new token family for a login from the given
+// client. Expired tokens of the user are cleaned up on the way.
+func (s *PostgresTokenStore) CreateTokenPair(userID int, ip string, userAgent string) (*TokenPair, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM tokens WHERE user_id = $1 AND expiry <= NOW()`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var familyID int
+	err = tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('tokens', 'id'))`).Scan(&familyID)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := s.issueTokenPair(tx, userID, familyID, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// UseRefreshToken rotates a refresh token: it is marked as used and a new
+// pair of the same family is issued. Presenting a refresh token that was
+// already used means it has leaked, so the whole family is revoked and
+// ErrRefreshTokenReused is returned.
+func (s *PostgresTokenStore) UseRefreshToken(plainTokenText string, ip string, userAgent string) (*TokenPair, error) {
+	tokenHash := sha256.Sum256([]byte(plainTokenText))
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID, familyID int
+	var usedAt *time.Time
+	err = tx.QueryRow(`
+		SELECT user_id, family_id, used_at
+		FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > NOW()
+		FOR UPDATE
+	`, tokenHash[:], tokens.ScopeRefresh).Scan(&userID, &familyID, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec(`DELETE FROM tokens WHERE family_id = $1`, familyID)
+		if err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec(`UPDATE tokens SET used_at = NOW() WHERE hash = $1`, tokenHash[:])
+	if err != nil {
+		return nil, err
+	}
+	pair, err := s.issueTokenPair(tx, userID, familyID, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (s *PostgresTokenStore) issueTokenPair(tx *sql.Tx, userID int, familyID int, ip string, userAgent string) (*TokenPair, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	pair := &TokenPair{}
+	issue := []struct {
+		token **tokens.Token
+		ttl   time.Duration
+		scope string
+	}{
+		{&pair.Access, tokens.AccessTokenTTL, tokens.ScopeAuth},
+		{&pair.Refresh, tokens.RefreshTokenTTL, tokens.ScopeRefresh},
+	}
+	if s.signAccess != nil {
+		access, err := s.signAccess(tx, userID, familyID)
+		if err != nil {
+			return nil, err
+		}
+		pair.Access = access
+		issue = issue[1:]
+	}
+	var err error
+	for _, t := range issue {
+		*t.token, err = tokens.GenerateToken(userID, t.ttl, t.scope)
+		if err != nil {
+			return nil, err
+		}
+		(*t.token).FamilyID = familyID
+		(*t.token).IP = ip
+		(*t.token).UserAgent = userAgent
+		if err = insertToken(tx, *t.token); err != nil {
+			return nil, err
+		}
+	}
+	return pair, nil
+}
+
+// DeleteToken revokes the token together with the rest of its family, so
+// that its refresh token cannot bring the session back.
+func (s *PostgresTokenStore) DeleteToken(scope string, plainTokenText string) error {
+	tokenHash := sha256.Sum256([]byte(plainTokenText))
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1
+		OR family_id = (SELECT family_id FROM tokens WHERE hash = $1 AND scope = $2)
+	`
+	_, err := s.db.Exec(query, tokenHash[:], scope)
+	return err
+}
+
+// ConsumeToken deletes an unexpired single-use token and returns the ID of
+// its user, 0 when there is no such token. Deleting it right away means two
+// concurrent requests cannot both use it.
+func (s *PostgresTokenStore) ConsumeToken(scope string, plainTokenText string) (int, error) {
+	tokenHash := sha256.Sum256([]byte(plainTokenText))
+	var userID int
+	err := s.db.QueryRow(`DELETE FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > NOW() RETURNING user_id`,
+		tokenHash[:], scope).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (s *PostgresTokenStore) ListSessions(userID int, currentToken string) ([]Session, error) {
+	currentHash := sha256.Sum256([]byte(currentToken))
+	query := `
+		SELECT family_id, MIN(created_at), MAX(last_used_at), MAX(expiry),
+			(array_agg(ip ORDER BY created_at DESC))[1], (array_agg(user_agent ORDER BY created_at DESC))[1],
+			bool_or(hash = $4)
+		FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3) AND expiry > NOW()
+		GROUP BY family_id
+		ORDER BY MAX(COALESCE(last_used_at, created_at)) DESC
+	`
+	rows, err := s.db.Query(query, userID, tokens.ScopeAuth, tokens.ScopeRefresh, currentHash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session := Session{}
+		err = rows.Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.Expiry, &session.IP,
+			&session.UserAgent, &session.Current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// DeleteSession revokes one of the user's sessions. It reports false when the
+// user has no such session.
+func (s *PostgresTokenStore) DeleteSession(userID int, sessionID int) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM tokens WHERE family_id = $1 AND user_id = $2 AND scope IN ($3, $4)`,
+		sessionID, userID, tokens.ScopeAuth, tokens.ScopeRefresh)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
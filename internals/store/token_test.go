@@ -0,0 +1,129 @@
+package store
+
+import (
+	"go_beginner/internals/tokens"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countFamilyTokens(t *testing.T, store *PostgresTokenStore, familyID int) int {
+	t.Helper()
+	var count int
+	err := store.db.QueryRow(`SELECT COUNT(*) FROM tokens WHERE family_id = $1`, familyID).Scan(&count)
+	require.NoError(t, err)
+	return count
+}
+
+func TestUseRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresTokenStore(db)
+	userID := createTestUser(t, db, "refresh-owner")
+
+	t.Run("rotation issues a new pair and the old token is then reused", func(t *testing.T) {
+		first, err := store.CreateTokenPair(userID, "192.0.2.1", "test")
+		require.NoError(t, err)
+		familyID := first.Refresh.FamilyID
+
+		second, err := store.UseRefreshToken(first.Refresh.PlainText, "192.0.2.1", "test")
+		require.NoError(t, err)
+		assert.NotEqual(t, first.Refresh.PlainText, second.Refresh.PlainText)
+		assert.NotEqual(t, first.Access.PlainText, second.Access.PlainText)
+		assert.Equal(t, familyID, second.Refresh.FamilyID)
+		assert.Equal(t, 4, countFamilyTokens(t, store, familyID))
+
+		_, err = store.UseRefreshToken(first.Refresh.PlainText, "198.51.100.7", "attacker")
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+		assert.Zero(t, countFamilyTokens(t, store, familyID), "reuse revokes the whole family")
+
+		_, err = store.UseRefreshToken(second.Refresh.PlainText, "192.0.2.1", "test")
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken, "the rotated token went with its family")
+	})
+
+	t.Run("rejects expired and unknown refresh tokens", func(t *testing.T) {
+		pair, err := store.CreateTokenPair(userID, "192.0.2.1", "test")
+		require.NoError(t, err)
+		_, err = db.Exec(`UPDATE tokens SET expiry = $1 WHERE family_id = $2`, time.Now().Add(-time.Minute), pair.Refresh.FamilyID)
+		require.NoError(t, err)
+
+		_, err = store.UseRefreshToken(pair.Refresh.PlainText, "192.0.2.1", "test")
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+		_, err = store.UseRefreshToken("not-a-token", "192.0.2.1", "test")
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+}
+
+func TestSessions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresTokenStore(db)
+	userID := createTestUser(t, db, "session-owner")
+	otherID := createTestUser(t, db, "session-other")
+
+	laptop, err := store.CreateTokenPair(userID, "192.0.2.1", "laptop")
+	require.NoError(t, err)
+	phone, err := store.CreateTokenPair(userID, "192.0.2.2", "phone")
+	require.NoError(t, err)
+	phone, err = store.UseRefreshToken(phone.Refresh.PlainText, "192.0.2.3", "phone")
+	require.NoError(t, err)
+	_, err = store.CreateTokenPair(otherID, "192.0.2.9", "other")
+	require.NoError(t, err)
+
+	t.Run("groups the tokens of a login into one session", func(t *testing.T) {
+		sessions, err := store.ListSessions(userID, laptop.Access.PlainText)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+
+		byID := map[int]Session{}
+		for _, session := range sessions {
+			byID[session.ID] = session
+		}
+		require.Contains(t, byID, laptop.Refresh.FamilyID)
+		require.Contains(t, byID, phone.Refresh.FamilyID)
+		assert.True(t, byID[laptop.Refresh.FamilyID].Current)
+		assert.False(t, byID[phone.Refresh.FamilyID].Current)
+		assert.Equal(t, "192.0.2.3", byID[phone.Refresh.FamilyID].IP, "the latest token's client")
+	})
+
+	t.Run("deletes only the user's own sessions", func(t *testing.T) {
+		deleted, err := store.DeleteSession(otherID, phone.Refresh.FamilyID)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+
+		deleted, err = store.DeleteSession(userID, phone.Refresh.FamilyID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		sessions, err := store.ListSessions(userID, laptop.Access.PlainText)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, laptop.Refresh.FamilyID, sessions[0].ID)
+
+		_, err = store.UseRefreshToken(phone.Refresh.PlainText, "192.0.2.3", "phone")
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("logs out everywhere", func(t *testing.T) {
+		_, err := store.CreateTokenPair(userID, "192.0.2.4", "tablet")
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteAllTokensForUser(userID, tokens.ScopeAuth))
+		require.NoError(t, store.DeleteAllTokensForUser(userID, tokens.ScopeRefresh))
+
+		sessions, err := store.ListSessions(userID, "")
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		others, err := store.ListSessions(otherID, "")
+		require.NoError(t, err)
+		assert.Len(t, others, 1, "other users stay logged in")
+	})
+}
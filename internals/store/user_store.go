@@ -6,16 +6,35 @@ import (
 	"errors"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"go_beginner/internals/passwords"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// passwordHasher hashes new passwords. Existing hashes are verified whatever
+// hasher made them.
+var passwordHasher passwords.Hasher = passwords.Bcrypt{Cost: 12}
+
+// SetPasswordHasher changes how new passwords are hashed. It is meant to be
+// called once at startup.
+func SetPasswordHasher(hasher passwords.Hasher) error {
+	// The dummy hash has to cost as much as real ones.
+	hash, err := hasher.Hash("dummy password")
+	if err != nil {
+		return err
+	}
+	passwordHasher = hasher
+	dummyPassword = password{hash: hash}
+	return nil
+}
+
 type password struct {
 	plainText *string
 	hash      []byte
 }
 
 func (p *password) Set(plainText string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainText), 12)
+	hash, err := passwordHasher.Hash(plainText)
 	if err != nil {
 		return err
 	}
@@ -28,11 +47,23 @@ func (p *password) Check(plainText string) (bool, error) {
 	if plainText == "" {
 		return false, errors.New("password is not set")
 	}
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plainText))
-	if err != nil {
-		return false, err
-	}
-	return true, nil
+	return passwords.Verify(p.hash, plainText)
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// other parameters than the current ones. After a successful Check, Set
+// the password again and store it with UpdatePassword.
+func (p *password) NeedsRehash() bool {
+	return passwordHasher.NeedsRehash(p.hash)
+}
+
+// dummyPassword has the same cost as real hashes. It is checked when nobody
+// has the email being logged in with, so that unknown emails take as long to
+// reject as wrong passwords.
+var dummyPassword = password{hash: []byte("$2a$12$FjWvkp1SwgyPiVlKc/aQye24L8CXPS472/PrqvQPl8Ig5yYk1kp3u")}
+
+func CheckDummyPassword(plainText string) {
+	_, _ = dummyPassword.Check(plainText)
 }
 
 type User struct {
@@ -41,12 +72,18 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash password  `json:"-"`
 	Bio          string    `json:"bio"`
+	Activated    bool      `json:"activated"` // email address confirmed
+	Role         string    `json:"role"`
+	// Permissions are only loaded for the authenticated user.
+	Permissions Permissions `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 var AnonymousUser = &User{}
 
+func (u *User) OwnerID() int { return u.ID }
+
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
@@ -64,27 +101,52 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 type UserStore interface {
 	CreateUser(*User) (*User, error)
 	GetUserByID(id int) (*User, error)
+	// UpdateUser stores name, email, bio and activated. The password only
+	// changes with UpdatePassword.
 	UpdateUser(id int, user *User) error
 	DeleteUser(id int) error
-	GetUsers() ([]User, error)
+	GetUsers(filter UserFilter) ([]User, error)
 	GetUserByEmail(email string) (*User, error)
 	GetUserToken(scope string, plainTokenText string) (*User, error)
+	UpdatePassword(user *User) error
+	ActivateUser(id int) error
+}
+
+var (
+	ErrDuplicateEmail = errors.New("a user with this email address already exists")
+	ErrDuplicateName  = errors.New("a user with this name already exists")
+)
+
+// userConstraintError turns violations of the unique name and email
+// constraints into ErrDuplicateName and ErrDuplicateEmail.
+func userConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "idx_users_email_lower":
+		return ErrDuplicateEmail
+	case "users_name_key":
+		return ErrDuplicateName
+	}
+	return err
 }
 
 func (s *PostgresUserStore) CreateUser(user *User) (*User, error) {
-	query := `INSERT INTO users (name, email, password, bio) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+	query := `INSERT INTO users (name, email, password, bio) VALUES ($1, $2, $3, $4) RETURNING id, role, created_at, updated_at`
 
-	err := s.db.QueryRow(query, user.Name, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, user.Name, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		return nil, err
+		return nil, userConstraintError(err)
 	}
 	return user, nil
 }
 
 func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
-	query := `SELECT id, name, email, password, bio, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, name, email, password, bio, activated, role, created_at, updated_at FROM users WHERE id = $1`
 	var user User
-	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.Activated, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil // No user found
@@ -96,27 +158,59 @@ func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
 }
 
 func (s *PostgresUserStore) UpdateUser(id int, user *User) error {
-	query := `UPDATE users SET name = $1, email = $2, password = $3, bio = $4, updated_at = NOW() WHERE id = $5`
-	_, err := s.db.Exec(query, user.Name, user.Email, user.PasswordHash.hash, user.Bio, id)
+	query := `UPDATE users SET name = $1, email = $2, bio = $3, activated = $4, updated_at = NOW() WHERE id = $5`
+	_, err := s.db.Exec(query, user.Name, user.Email, user.Bio, user.Activated, id)
+	return userConstraintError(err)
+}
+
+func (s *PostgresUserStore) ActivateUser(id int) error {
+	query := `UPDATE users SET activated = true, updated_at = NOW() WHERE id = $1`
+	_, err := s.db.Exec(query, id)
 	return err
 }
+// UpdatePassword stores the hash set with user.PasswordHash.Set.
+func (s *PostgresUserStore) UpdatePassword(user *User) error {
+	query := `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2`
+	_, err := s.db.Exec(query, user.PasswordHash.hash, user.ID)
+	return err
+}
+
 func (s *PostgresUserStore) DeleteUser(id int) error {
 	query := `DELETE FROM users WHERE id = $1`
 	_, err := s.db.Exec(query, id)
 	return err
 }
-func (s *PostgresUserStore) GetUsers() ([]User, error) {
-	query := `SELECT id, name, email, password, bio, created_at, updated_at FROM users`
-	rows, err := s.db.Query(query)
+// UserFilter narrows GetUsers. Search matches the name or email.
+type UserFilter struct {
+	Search string
+	Role   string
+	Limit  int
+	Offset int
+}
+
+func (s *PostgresUserStore) GetUsers(filter UserFilter) ([]User, error) {
+	query := `
+	SELECT id, name, email, password, bio, activated, role, created_at, updated_at
+	FROM users
+	WHERE ($1 = '' OR name ILIKE $1 OR email ILIKE $1)
+	AND ($2 = '' OR role = $2)
+	ORDER BY id
+	LIMIT $3 OFFSET $4
+	`
+	pattern := ""
+	if filter.Search != "" {
+		pattern = "%" + escapeLike(filter.Search) + "%"
+	}
+	rows, err := s.db.Query(query, pattern, filter.Role, filter.Limit, filter.Offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []User
+	users := []User{}
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt)
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.Activated, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -126,9 +220,9 @@ func (s *PostgresUserStore) GetUsers() ([]User, error) {
 }
 
 func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
-	query := `SELECT id, name, email, password, bio, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, name, email, password, bio, activated, role, created_at, updated_at FROM users WHERE LOWER(email) = LOWER($1)`
 	var user User
-	err := s.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.Activated, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil // No user found
 	}
@@ -140,11 +234,18 @@ func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
 
 func (s *PostgresUserStore) GetUserToken(scope string, plainTokenText string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(plainTokenText))
+	// Looking the token up also records when it was last used, for the
+	// session list.
 	query := `
-	SELECT u.id, u.name, u.email, u.password, u.bio, u.created_at, u.updated_at
+	WITH t AS (
+		UPDATE tokens SET last_used_at = NOW()
+		WHERE hash = $1 AND scope = $2 AND expiry > $3
+		RETURNING user_id
+	)
+	SELECT u.id, u.name, u.email, u.password, u.bio, u.activated, u.role, u.created_at, u.updated_at,
+		COALESCE((SELECT string_agg(rp.permission, ',') FROM role_permissions rp WHERE rp.role = u.role), '')
 	FROM users u
-	INNER JOIN tokens t ON u.id = t.user_id
-	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
+	INNER JOIN t ON u.id = t.user_id
 	`
 	user := &User{
 		PasswordHash: password{},
@@ -156,8 +257,11 @@ func (s *PostgresUserStore) GetUserToken(scope string, plainTokenText string) (*
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Permissions,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil // No user found
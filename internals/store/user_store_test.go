@@ -0,0 +1,59 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUserKeepsPassword(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresUserStore(db)
+	user := &User{Name: "jane", Email: "jane@example.com", Bio: "lifts"}
+	require.NoError(t, user.PasswordHash.Set("correct horse"))
+	_, err = store.CreateUser(user)
+	require.NoError(t, err)
+
+	// A user as loaded for an update, without the password hash.
+	update := &User{Name: "jane.doe", Email: "jane.doe@example.com", Bio: "", Activated: false}
+	require.NoError(t, store.UpdateUser(user.ID, update))
+
+	updated, err := store.GetUserByID(user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, "jane.doe", updated.Name)
+	assert.Equal(t, "jane.doe@example.com", updated.Email)
+	assert.Empty(t, updated.Bio, "the bio can be cleared")
+	matches, err := updated.PasswordHash.Check("correct horse")
+	require.NoError(t, err)
+	assert.True(t, matches, "the password is untouched")
+}
+
+func TestGetUsersSearch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresUserStore(db)
+	underscore := createTestUser(t, db, "jane_doe")
+	createTestUser(t, db, "janexdoe")
+
+	users, err := store.GetUsers(UserFilter{Search: "E_D", Limit: 50})
+	require.NoError(t, err)
+	require.Len(t, users, 1, "_ is not a wildcard")
+	assert.Equal(t, underscore, users[0].ID)
+
+	users, err = store.GetUsers(UserFilter{Search: "%", Limit: 50})
+	require.NoError(t, err)
+	assert.Empty(t, users, "% is not a wildcard")
+
+	users, err = store.GetUsers(UserFilter{Search: "doe@example", Limit: 50})
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	SetTypeWarmup  = "warmup"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+// WorkoutSet is a single logged set of a workout entry. Like the entry itself
+// a set is either rep based or time based.
+type WorkoutSet struct {
+	ID              int      `json:"id"`
+	SetType         string   `json:"set_type"` // warmup, working, drop or failure
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	WeightKg        *float64 `json:"weight"` // in kilograms
+	DistanceMeters  *float64 `json:"distance_meters"`
+	RPE             *float64 `json:"rpe"`
+	RIR             *int     `json:"rir"`
+	RestSeconds     *int     `json:"rest_seconds"`
+}
+
+func (s *WorkoutSet) validate() error {
+	switch s.SetType {
+	case "":
+		s.SetType = SetTypeWorking
+	case SetTypeWarmup, SetTypeWorking, SetTypeDrop, SetTypeFailure:
+	default:
+		return fmt.Errorf("unknown set type %q", s.SetType)
+	}
+	if (s.Reps == nil) == (s.DurationSeconds == nil) {
+		return fmt.Errorf("a set needs either reps or duration_seconds")
+	}
+	if s.Reps != nil && *s.Reps < 0 || s.DurationSeconds != nil && *s.DurationSeconds < 0 {
+		return fmt.Errorf("reps and duration_seconds cannot be negative")
+	}
+	if s.WeightKg != nil && *s.WeightKg < 0 {
+		return fmt.Errorf("weight cannot be negative")
+	}
+	if s.DistanceMeters != nil && *s.DistanceMeters < 0 {
+		return fmt.Errorf("distance_meters cannot be negative")
+	}
+	if s.RPE != nil && (*s.RPE < 1 || *s.RPE > 10) {
+		return fmt.Errorf("rpe must be between 1 and 10")
+	}
+	if s.RIR != nil && *s.RIR < 0 {
+		return fmt.Errorf("rir cannot be negative")
+	}
+	if s.RestSeconds != nil && *s.RestSeconds < 0 {
+		return fmt.Errorf("rest_seconds cannot be negative")
+	}
+	return nil
+}
+
+// prepareEntrySets keeps the per-set details and the legacy sets/reps/weight
+// fields of an entry in sync. Old clients only send the legacy fields, which
+// are expanded into identical working sets; new clients send set_details and
+// the legacy fields are derived from the top set.
+func prepareEntrySets(entry *WorkoutEntry) error {
+	if len(entry.SetDetails) == 0 {
+		if entry.Sets < 1 {
+			entry.Sets = 1
+		}
+		entry.SetDetails = make([]WorkoutSet, entry.Sets)
+		for i := range entry.SetDetails {
+			entry.SetDetails[i] = WorkoutSet{
+				SetType:         SetTypeWorking,
+				Reps:            entry.Reps,
+				DurationSeconds: entry.DurationSeconds,
+				WeightKg:        entry.WeightKg,
+			}
+		}
+	}
+
+	var top *WorkoutSet
+	working := 0
+	for i := range entry.SetDetails {
+		set := &entry.SetDetails[i]
+		if err := set.validate(); err != nil {
+			return fmt.Errorf("%w: %s: set %d: %v", ErrInvalidWorkout, entry.ExerciseName, i+1, err)
+		}
+		if set.SetType == SetTypeWarmup {
+			continue
+		}
+		working++
+		if top == nil || isHeavierSet(set, top) {
+			top = set
+		}
+	}
+	if top == nil {
+		// only warm-up sets were logged
+		top = &entry.SetDetails[0]
+		working = len(entry.SetDetails)
+	}
+
+	entry.Sets = working
+	entry.Reps = top.Reps
+	entry.DurationSeconds = top.DurationSeconds
+	entry.WeightKg = top.WeightKg
+	return nil
+}
+
+// isHeavierSet orders sets by weight, then by reps or duration.
+func isHeavierSet(a, b *WorkoutSet) bool {
+	aw, bw := derefFloat(a.WeightKg), derefFloat(b.WeightKg)
+	if aw != bw {
+		return aw > bw
+	}
+	return derefInt(a.Reps)+derefInt(a.DurationSeconds) > derefInt(b.Reps)+derefInt(b.DurationSeconds)
+}
+
+func insertEntrySets(tx *sql.Tx, entry *WorkoutEntry) error {
+	query := `
+		INSERT INTO workout_entry_sets (entry_id, set_index, set_type, reps, duration_seconds,
+		weight, distance_meters, rpe, rir, rest_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+	for i := range entry.SetDetails {
+		set := &entry.SetDetails[i]
+		err := tx.QueryRow(query, entry.ID, i+1, set.SetType, set.Reps, set.DurationSeconds,
+			set.WeightKg, set.DistanceMeters, set.RPE, set.RIR, set.RestSeconds).Scan(&set.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadEntrySets fills in the set details of all given entries with a single
+// query.
+func loadEntrySets(q queryer, entries []*WorkoutEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(entries))
+	byID := make(map[int]*WorkoutEntry, len(entries))
+	for i, entry := range entries {
+		ids[i] = int64(entry.ID)
+		byID[entry.ID] = entry
+	}
+
+	query := `
+		SELECT entry_id, id, set_type, reps, duration_seconds, weight, distance_meters, rpe, rir, rest_seconds
+		FROM workout_entry_sets
+		WHERE entry_id = ANY($1)
+		ORDER BY entry_id, set_index
+	`
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query workout sets: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryID int
+		set := WorkoutSet{}
+		err = rows.Scan(
+			&entryID,
+			&set.ID,
+			&set.SetType,
+			&set.Reps,
+			&set.DurationSeconds,
+			&set.WeightKg,
+			&set.DistanceMeters,
+			&set.RPE,
+			&set.RIR,
+			&set.RestSeconds)
+		if err != nil {
+			return fmt.Errorf("failed to scan workout set: %w", err)
+		}
+		entry := byID[entryID]
+		entry.SetDetails = append(entry.SetDetails, set)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over workout sets: %w", err)
+	}
+	return nil
+}
+
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func derefFloat(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
@@ -2,7 +2,13 @@ package store
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Workout struct {
@@ -12,11 +18,22 @@ type Workout struct {
 	DurationMinutes int            `json:"duration_minutes"`
 	CaloriesBurned  int            `json:"calories_burned"`
 	UserId          int            `json:"user_id"`
+	PerformedAt     time.Time      `json:"performed_at"`
+	StartedAt       *time.Time     `json:"started_at"`
+	EndedAt         *time.Time     `json:"ended_at"`
+	Timezone        string         `json:"timezone"` // IANA name, e.g. "Europe/Berlin"
+	TemplateID      *int           `json:"template_id"`
+	ProgramDayID    *int           `json:"program_day_id"` // logged against a day of the active program
+	CreatedAt       time.Time      `json:"created_at"`
 	Entries         []WorkoutEntry `json:"entries"`
+	// NewRecords lists the personal records set by this workout; only
+	// filled in when the workout is created or updated.
+	NewRecords []PersonalRecord `json:"new_records,omitempty"`
 }
 
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"` // resolved from ExerciseName when not given
 	ExerciseName    string   `json:"exercise_name"`
 	Sets            int      `json:"sets"`
 	Reps            *int     `json:"reps"`
@@ -24,6 +41,9 @@ type WorkoutEntry struct {
 	WeightKg        *float64 `json:"weight"`           // in kilograms
 	Notes           *string  `json:"notes"`
 	OrderIndex      int      `json:"order_index"` // to maintain the order of entries
+	// SetDetails holds every logged set. Sets, Reps, DurationSeconds and
+	// WeightKg are derived from it for clients that predate per-set logging.
+	SetDetails []WorkoutSet `json:"set_details"`
 }
 
 type PostgresWorkoutStore struct {
@@ -42,15 +62,160 @@ type WorkoutStore interface {
 	UpdateWorkout(id int, workout *Workout) error
 	DeleteWorkout(id int) error
 	GetWorkouts() ([]Workout, error)
+	ListWorkouts(filter WorkoutFilter) (*WorkoutPage, error)
 	GetWorkoutOwnerId(id int) (int, error)
+	GetLatestWorkoutForTemplate(templateID int, userID int) (*Workout, error)
 }
 
-func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
+func (w *Workout) OwnerID() int { return w.UserId }
+
+var (
+	ErrInvalidWorkout = errors.New("invalid workout")
+	ErrInvalidSort    = errors.New("invalid sort field")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+)
+
+const workoutColumns = `w.id, w.title, w.description, w.duration_minutes, w.calories_burned, w.user_id,
+	w.performed_at, w.started_at, w.ended_at, w.timezone, w.template_id,
+	w.program_day_id, w.created_at`
+
+// workoutLocalDate is the calendar day a workout was performed on in the
+// workout's own timezone. Date filters and day/week grouping use it so that a
+// late evening session doesn't land on the next day in UTC.
+const workoutLocalDate = `(w.performed_at AT TIME ZONE w.timezone)::date`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWorkout(row rowScanner, workout *Workout) error {
+	return row.Scan(
+		&workout.ID,
+		&workout.Title,
+		&workout.Description,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.UserId,
+		&workout.PerformedAt,
+		&workout.StartedAt,
+		&workout.EndedAt,
+		&workout.Timezone,
+		&workout.TemplateID,
+		&workout.ProgramDayID,
+		&workout.CreatedAt)
+}
+
+// prepareWorkout validates a workout before it is written and fills in the
+// derived fields: the timezone defaults to UTC, the performed-at time to the
+// start time (or now), and the duration is taken from start/end when unset.
+func prepareWorkout(workout *Workout) error {
 	if workout.Title == "" {
-		return nil, fmt.Errorf("workout title is required")
+		return fmt.Errorf("%w: workout title is required", ErrInvalidWorkout)
 	}
 	if workout.DurationMinutes < 0 {
-		return nil, fmt.Errorf("workout duration cannot be negative")
+		return fmt.Errorf("%w: workout duration cannot be negative", ErrInvalidWorkout)
+	}
+	if workout.Timezone == "" {
+		workout.Timezone = "UTC"
+	}
+	if _, err := LoadTimezone(workout.Timezone); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWorkout, err)
+	}
+	if workout.StartedAt != nil && workout.EndedAt != nil {
+		if workout.EndedAt.Before(*workout.StartedAt) {
+			return fmt.Errorf("%w: ended_at must not be before started_at", ErrInvalidWorkout)
+		}
+		workout.DurationMinutes = workout.Duration()
+	}
+	if workout.PerformedAt.IsZero() {
+		if workout.StartedAt != nil {
+			workout.PerformedAt = *workout.StartedAt
+		} else {
+			workout.PerformedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+// Duration is DurationMinutes, or the minutes from StartedAt to EndedAt when
+// it is unset.
+func (w *Workout) Duration() int {
+	if w.DurationMinutes == 0 && w.StartedAt != nil && w.EndedAt != nil {
+		return int(w.EndedAt.Sub(*w.StartedAt).Round(time.Minute) / time.Minute)
+	}
+	return w.DurationMinutes
+}
+
+// LoadTimezone resolves an IANA timezone name. Unlike time.LoadLocation it
+// rejects "Local", which would depend on the server's configuration.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+const (
+	DefaultWorkoutPageSize = 20
+	MaxWorkoutPageSize     = 100
+)
+
+// WorkoutFilter narrows down ListWorkouts. Nil pointers and empty strings
+// mean "no constraint". From and To are inclusive calendar days.
+type WorkoutFilter struct {
+	UserID      int
+	From        *time.Time
+	To          *time.Time
+	Search      string // matched against the title and the exercise names
+	ExerciseID  *int
+	MinDuration *int
+	MaxDuration *int
+	MinCalories *int
+	MaxCalories *int
+	Sort        string // field name, prefixed with "-" for descending order
+	Cursor      string
+	Limit       int
+}
+
+type WorkoutPage struct {
+	Workouts   []Workout
+	NextCursor string
+	TotalCount int
+}
+
+type workoutSortColumn struct {
+	column string
+	cast   string
+}
+
+var workoutSortColumns = map[string]workoutSortColumn{
+	"performed_at":     {column: "w.performed_at", cast: "timestamptz"},
+	"created_at":       {column: "w.created_at", cast: "timestamptz"},
+	"duration_minutes": {column: "w.duration_minutes", cast: "int"},
+	"calories_burned":  {column: "w.calories_burned", cast: "int"},
+	"title":            {column: "w.title", cast: "text"},
+}
+
+// workoutCursor is the keyset position of the last row of a page: the value
+// of the sort column and the workout id as a tie breaker.
+type workoutCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
+	if err := prepareWorkout(workout); err != nil {
+		return nil, err
+	}
+	for i := range workout.Entries {
+		if err := prepareEntrySets(&workout.Entries[i]); err != nil {
+			return nil, err
+		}
 	}
 
 	tx, err := pg.db.Begin()
@@ -60,34 +225,35 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	defer tx.Rollback()
 
 	query := `
-		 INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-		 VALUES ($1, $2, $3, $4, $5)
-		 RETURNING id, title, description
+		 INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned,
+		 performed_at, started_at, ended_at, timezone, template_id, program_day_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 RETURNING id, title, description, created_at
 	`
-	err = tx.QueryRow(query, workout.UserId, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(
+	err = tx.QueryRow(query, workout.UserId, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned,
+		workout.PerformedAt, workout.StartedAt, workout.EndedAt, workout.Timezone, workout.TemplateID, workout.ProgramDayID).Scan(
 		&workout.ID,
 		&workout.Title,
-		&workout.Description)
+		&workout.Description,
+		&workout.CreatedAt)
 
 	if err != nil {
 		return nil, err
 	}
 
-	for _, entry := range workout.Entries {
-		entryQuery := `		 
-			INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds,
-			weight, notes, order_index)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id, exercise_name
-		`
-		err = tx.QueryRow(entryQuery, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps,
-			entry.DurationSeconds, entry.WeightKg, entry.Notes, entry.OrderIndex).Scan(
-			&entry.ID,
-			&entry.ExerciseName)
+	err = insertWorkoutEntries(tx, workout.ID, workout.UserId, workout.Entries)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	err = recordProgramCompletion(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.NewRecords, err = recomputePersonalRecords(tx, workout.UserId, workout.ID, workout.Entries)
+	if err != nil {
+		return nil, err
 	}
 
 	err = tx.Commit()
@@ -99,17 +265,12 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 
 func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 	query := `
-		SELECT id, title, description, duration_minutes, calories_burned
-		FROM workouts
-		WHERE id = $1
+		SELECT ` + workoutColumns + `
+		FROM workouts w
+		WHERE w.id = $1
 	`
 	workout := &Workout{}
-	err := pg.db.QueryRow(query, id).Scan(
-		&workout.ID,
-		&workout.Title,
-		&workout.Description,
-		&workout.DurationMinutes,
-		&workout.CaloriesBurned)
+	err := scanWorkout(pg.db.QueryRow(query, id), workout)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -118,65 +279,86 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 		return nil, err
 	}
 
-	entryQuery := `
-		SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-		FROM workout_entries
-		WHERE workout_id = $1
-	`
-	rows, err := pg.db.Query(entryQuery, id)
-	if err == sql.ErrNoRows {
-		return nil, nil // No entries found
-	}
+	workouts := []Workout{*workout}
+	err = loadWorkoutEntries(pg.db, workouts)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		entry := WorkoutEntry{}
-		err = rows.Scan(
-			&entry.ID,
-			&entry.ExerciseName,
-			&entry.Sets,
-			&entry.Reps,
-			&entry.DurationSeconds,
-			&entry.WeightKg,
-			&entry.Notes,
-			&entry.OrderIndex)
+	return &workouts[0], nil
+}
 
+func insertWorkoutEntries(tx *sql.Tx, workoutID int, userID int, entries []WorkoutEntry) error {
+	entryQuery := `
+		INSERT INTO workout_entries (workout_id, exercise_id, exercise_name, sets, reps, duration_seconds,
+		weight, notes, order_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	for i := range entries {
+		entry := &entries[i]
+		err := linkEntryExercise(tx, entry, userID)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		err = tx.QueryRow(entryQuery, workoutID, entry.ExerciseID, entry.ExerciseName, entry.Sets, entry.Reps,
+			entry.DurationSeconds, entry.WeightKg, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+		err = insertEntrySets(tx, entry)
+		if err != nil {
+			return err
 		}
-
-		workout.Entries = append(workout.Entries, entry)
 	}
+	return nil
+}
 
-	return workout, nil
+// linkEntryExercise checks an explicit exercise_id against the catalog, or
+// resolves the free-text exercise name through the names and aliases.
+func linkEntryExercise(tx *sql.Tx, entry *WorkoutEntry, userID int) error {
+	var err error
+	entry.ExerciseID, entry.ExerciseName, err = linkExercise(tx, entry.ExerciseID, entry.ExerciseName, userID)
+	return err
 }
 
 func (pg *PostgresWorkoutStore) UpdateWorkout(id int, workout *Workout) error {
+	if err := prepareWorkout(workout); err != nil {
+		return err
+	}
+	for i := range workout.Entries {
+		if err := prepareEntrySets(&workout.Entries[i]); err != nil {
+			return err
+		}
+	}
+
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	existingWorkout, err := pg.GetWorkoutByID(id)
+	// Lock the row so that concurrent updates recompute the records from the
+	// entries the other one saved.
+	existing := []Workout{{}}
+	err = scanWorkout(tx.QueryRow(`SELECT `+workoutColumns+` FROM workouts w WHERE w.id = $1 FOR UPDATE`, id), &existing[0])
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("workout with ID %d not found", id)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get existing workout: %v", err)
 	}
-	if existingWorkout == nil {
-		return fmt.Errorf("workout with ID %d not found", id)
+	if err = loadWorkoutEntries(tx, existing); err != nil {
+		return fmt.Errorf("failed to get existing workout: %v", err)
 	}
 
 	query := `UPDATE workouts
-		SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-		WHERE id = $5
-		RETURNING id, title, description, duration_minutes, calories_burned
+		SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4,
+		performed_at = $5, started_at = $6, ended_at = $7, timezone = $8, updated_at = NOW()
+		WHERE id = $9
 	`
 	res, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes,
-		workout.CaloriesBurned, id)
+		workout.CaloriesBurned, workout.PerformedAt, workout.StartedAt, workout.EndedAt, workout.Timezone, id)
 	if err != nil {
 		return err
 	}
@@ -188,20 +370,19 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(id int, workout *Workout) error {
 		return fmt.Errorf("workout with ID %d not found", id)
 	}
 
-	tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, id)
-	for _, entry := range workout.Entries {
-		entryQuery := `
-			INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds,
-			weight, notes, order_index)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id
-		`
-		_, err = tx.Exec(entryQuery, id, entry.ExerciseName, entry.Sets, entry.Reps,
-			entry.DurationSeconds, entry.WeightKg, entry.Notes, entry.OrderIndex)
+	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	err = insertWorkoutEntries(tx, id, workout.UserId, workout.Entries)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
-		}
+	// Entries that were removed or renamed may have held records too.
+	workout.NewRecords, err = recomputePersonalRecords(tx, workout.UserId, id, existing[0].Entries, workout.Entries)
+	if err != nil {
+		return err
 	}
 
 	err = tx.Commit()
@@ -215,6 +396,14 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(id int, workout *Workout) error {
 }
 
 func (pg *PostgresWorkoutStore) DeleteWorkout(id int) error {
+	existingWorkout, err := pg.GetWorkoutByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get existing workout: %v", err)
+	}
+	if existingWorkout == nil {
+		return fmt.Errorf("workout with ID %d not found", id)
+	}
+
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
@@ -239,6 +428,11 @@ func (pg *PostgresWorkoutStore) DeleteWorkout(id int) error {
 		return fmt.Errorf("workout with ID %d not found", id)
 	}
 
+	_, err = recomputePersonalRecords(tx, existingWorkout.UserId, id, existingWorkout.Entries)
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -248,8 +442,9 @@ func (pg *PostgresWorkoutStore) DeleteWorkout(id int) error {
 
 func (pg *PostgresWorkoutStore) GetWorkouts() ([]Workout, error) { // TODO: change to apiWorkout, error) {
 	query := `
-		SELECT id, title, description, duration_minutes, calories_burned, user_id
-		FROM workouts
+		SELECT ` + workoutColumns + `
+		FROM workouts w
+		ORDER BY w.id
 	`
 	rows, err := pg.db.Query(query)
 	if err != nil {
@@ -259,54 +454,83 @@ func (pg *PostgresWorkoutStore) GetWorkouts() ([]Workout, error) { // TODO: chan
 	var workouts []Workout
 	for rows.Next() {
 		workout := Workout{}
-		err = rows.Scan(
-			&workout.ID,
-			&workout.Title,
-			&workout.Description,
-			&workout.DurationMinutes,
-			&workout.CaloriesBurned,
-			&workout.UserId,
-		)
+		err = scanWorkout(rows, &workout)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan workout: %w", err)
 		}
-		// Fetch entries for each workout
-		entryQuery := `			SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-			FROM workout_entries
-			WHERE workout_id = $1
-		`
-		entryRows, err := pg.db.Query(entryQuery, workout.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to query workout entries: %w", err)
-		}
-		defer entryRows.Close()
-		for entryRows.Next() {
-			entry := WorkoutEntry{}
-			err = entryRows.Scan(
-				&entry.ID,
-				&entry.ExerciseName,
-				&entry.Sets,
-				&entry.Reps,
-				&entry.DurationSeconds,
-				&entry.WeightKg,
-				&entry.Notes,
-				&entry.OrderIndex)
-			if err != nil {
-				return nil, fmt.Errorf("failed to scan workout entry: %w", err)
-			}
-			workout.Entries = append(workout.Entries, entry)
-		}
-		if err = entryRows.Err(); err != nil {
-			return nil, fmt.Errorf("error iterating over workout entries: %w", err)
-		}
 		workouts = append(workouts, workout)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over workouts: %w", err)
 	}
+	if err = loadWorkoutEntries(pg.db, workouts); err != nil {
+		return nil, err
+	}
 	return workouts, nil
 }
 
+// queryer runs queries on the pool or inside a transaction.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadWorkoutEntries fills in the entries of all given workouts with a single
+// query instead of one query per workout.
+func loadWorkoutEntries(q queryer, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(workouts))
+	byID := make(map[int]*Workout, len(workouts))
+	for i := range workouts {
+		ids[i] = int64(workouts[i].ID)
+		byID[workouts[i].ID] = &workouts[i]
+	}
+
+	entryQuery := `
+		SELECT workout_id, id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+		FROM workout_entries
+		WHERE workout_id = ANY($1)
+		ORDER BY workout_id, order_index, id
+	`
+	rows, err := q.Query(entryQuery, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query workout entries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var workoutID int
+		entry := WorkoutEntry{}
+		err = rows.Scan(
+			&workoutID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.Sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.WeightKg,
+			&entry.Notes,
+			&entry.OrderIndex)
+		if err != nil {
+			return fmt.Errorf("failed to scan workout entry: %w", err)
+		}
+		workout := byID[workoutID]
+		workout.Entries = append(workout.Entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over workout entries: %w", err)
+	}
+
+	var entries []*WorkoutEntry
+	for i := range workouts {
+		for j := range workouts[i].Entries {
+			entries = append(entries, &workouts[i].Entries[j])
+		}
+	}
+	return loadEntrySets(q, entries)
+}
+
 func (pg *PostgresWorkoutStore) GetWorkoutOwnerId(id int) (int, error) {
 	var userId int
 
@@ -320,3 +544,168 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwnerId(id int) (int, error) {
 
 	return userId, nil
 }
+
+func (pg *PostgresWorkoutStore) ListWorkouts(filter WorkoutFilter) (*WorkoutPage, error) {
+	sortField, desc := strings.CutPrefix(filter.Sort, "-")
+	if sortField == "" {
+		sortField, desc = "performed_at", true
+	}
+	sortColumn, ok := workoutSortColumns[sortField]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultWorkoutPageSize
+	}
+	if filter.Limit > MaxWorkoutPageSize {
+		filter.Limit = MaxWorkoutPageSize
+	}
+
+	conditions := []string{"w.user_id = $1"}
+	args := []any{filter.UserID}
+	// where adds a condition; the format verb is replaced by the placeholder
+	// of the argument, use %[1]d to reference it more than once.
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.From != nil {
+		where(workoutLocalDate+" >= $%d::date", filter.From.Format(time.DateOnly))
+	}
+	if filter.To != nil {
+		where(workoutLocalDate+" <= $%d::date", filter.To.Format(time.DateOnly))
+	}
+	if filter.Search != "" {
+		where(`(w.title ILIKE $%[1]d OR EXISTS (
+			SELECT 1 FROM workout_entries e WHERE e.workout_id = w.id AND e.exercise_name ILIKE $%[1]d))`,
+			"%"+escapeLike(filter.Search)+"%")
+	}
+	if filter.ExerciseID != nil {
+		where("EXISTS (SELECT 1 FROM workout_entries e WHERE e.workout_id = w.id AND e.exercise_id = $%d)", *filter.ExerciseID)
+	}
+	if filter.MinDuration != nil {
+		where("w.duration_minutes >= $%d", *filter.MinDuration)
+	}
+	if filter.MaxDuration != nil {
+		where("w.duration_minutes <= $%d", *filter.MaxDuration)
+	}
+	if filter.MinCalories != nil {
+		where("w.calories_burned >= $%d", *filter.MinCalories)
+	}
+	if filter.MaxCalories != nil {
+		where("w.calories_burned <= $%d", *filter.MaxCalories)
+	}
+
+	page := &WorkoutPage{Workouts: []Workout{}}
+	countQuery := `SELECT COUNT(*) FROM workouts w WHERE ` + strings.Join(conditions, " AND ")
+	err := pg.db.QueryRow(countQuery, args...).Scan(&page.TotalCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count workouts: %w", err)
+	}
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeWorkoutCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort {
+			return nil, ErrInvalidCursor
+		}
+		args = append(args, cursor.Value, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, w.id) %s ($%d::%s, $%d)",
+			sortColumn.column, comparison, len(args)-1, sortColumn.cast, len(args)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM workouts w
+		WHERE %s
+		ORDER BY %s %s, w.id %s
+		LIMIT %d
+	`, workoutColumns, strings.Join(conditions, " AND "), sortColumn.column, direction, direction, filter.Limit+1)
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workouts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		workout := Workout{}
+		err = scanWorkout(rows, &workout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workout: %w", err)
+		}
+		page.Workouts = append(page.Workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over workouts: %w", err)
+	}
+
+	if len(page.Workouts) > filter.Limit {
+		page.Workouts = page.Workouts[:filter.Limit]
+		last := page.Workouts[len(page.Workouts)-1]
+		page.NextCursor = encodeWorkoutCursor(workoutCursor{Sort: filter.Sort, Value: workoutSortValue(last, sortField), ID: last.ID})
+	}
+
+	if err = loadWorkoutEntries(pg.db, page.Workouts); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func workoutSortValue(workout Workout, field string) string {
+	switch field {
+	case "duration_minutes":
+		return strconv.Itoa(workout.DurationMinutes)
+	case "calories_burned":
+		return strconv.Itoa(workout.CaloriesBurned)
+	case "title":
+		return workout.Title
+	case "created_at":
+		return workout.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		return workout.PerformedAt.Format(time.RFC3339Nano)
+	}
+}
+
+func encodeWorkoutCursor(cursor workoutCursor) string {
+	js, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeWorkoutCursor(s string) (workoutCursor, error) {
+	var cursor workoutCursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(js, &cursor); err != nil || cursor.ID <= 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (pg *PostgresWorkoutStore) GetLatestWorkoutForTemplate(templateID int, userID int) (*Workout, error) {
+	query := `
+		SELECT id FROM workouts
+		WHERE template_id = $1 AND user_id = $2
+		ORDER BY performed_at DESC, id DESC
+		LIMIT 1
+	`
+	var id int
+	err := pg.db.QueryRow(query, templateID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pg.GetWorkoutByID(id)
+}
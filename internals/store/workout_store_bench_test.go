@@ -0,0 +1,129 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+)
+
+const benchmarkWorkoutCount = 10000
+
+// seedBenchmarkWorkouts inserts benchmarkWorkoutCount workouts with three
+// entries of three sets each for a single user and returns that user's id.
+func seedBenchmarkWorkouts(b *testing.B, db *sql.DB) int {
+	b.Helper()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	if err != nil {
+		b.Fatalf("truncating users %v", err)
+	}
+	var userID int
+	err = db.QueryRow(`INSERT INTO users (name, email, password) VALUES ('bench', 'bench@example.com', 'not-a-hash') RETURNING id`).Scan(&userID)
+	if err != nil {
+		b.Fatalf("creating user %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
+		SELECT $1, 'Workout ' || i, 'benchmark', 30 + i % 60, 200 + i % 400
+		FROM generate_series(1, $2) AS i
+	`, userID, benchmarkWorkoutCount)
+	if err != nil {
+		b.Fatalf("seeding workouts %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, weight, order_index)
+		SELECT w.id, 'Exercise ' || n, 3, 8, 60, n
+		FROM workouts w CROSS JOIN generate_series(1, 3) AS n
+	`)
+	if err != nil {
+		b.Fatalf("seeding workout entries %v", err)
+	}
+	// One set row per set, as the 00007 migration backfilled them.
+	_, err = db.Exec(`
+		INSERT INTO workout_entry_sets (entry_id, set_index, set_type, reps, duration_seconds, weight)
+		SELECT e.id, n, 'working', e.reps, e.duration_seconds, e.weight
+		FROM workout_entries e
+		CROSS JOIN LATERAL generate_series(1, GREATEST(e.sets, 1)) AS n
+	`)
+	if err != nil {
+		b.Fatalf("seeding workout entry sets %v", err)
+	}
+	return userID
+}
+
+// getWorkoutsPerRow is the previous implementation of GetWorkouts that ran
+// one entry query per workout, kept as the baseline for the benchmark.
+func getWorkoutsPerRow(db *sql.DB) ([]Workout, error) {
+	rows, err := db.Query(`SELECT id, title, description, duration_minutes, calories_burned, user_id FROM workouts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var workouts []Workout
+	for rows.Next() {
+		workout := Workout{}
+		err = rows.Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes,
+			&workout.CaloriesBurned, &workout.UserId)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	for i := range workouts {
+		entryRows, err := db.Query(`
+			SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+			FROM workout_entries WHERE workout_id = $1
+		`, workouts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for entryRows.Next() {
+			entry := WorkoutEntry{}
+			err = entryRows.Scan(&entry.ID, &entry.ExerciseName, &entry.Sets, &entry.Reps,
+				&entry.DurationSeconds, &entry.WeightKg, &entry.Notes, &entry.OrderIndex)
+			if err != nil {
+				entryRows.Close()
+				return nil, err
+			}
+			workouts[i].Entries = append(workouts[i].Entries, entry)
+		}
+		entryRows.Close()
+	}
+	return workouts, nil
+}
+
+func BenchmarkGetWorkouts(b *testing.B) {
+	db := setupTestDB(b)
+	defer db.Close()
+	userID := seedBenchmarkWorkouts(b, db)
+	store := NewPostgresWorkoutStore(db)
+
+	check := func(workouts []Workout, err error) {
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(workouts) != benchmarkWorkoutCount {
+			b.Fatalf("got %d workouts, want %d", len(workouts), benchmarkWorkoutCount)
+		}
+	}
+
+	b.Run("per-row entry queries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			check(getWorkoutsPerRow(db))
+		}
+	})
+	b.Run("batched entry query", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			check(store.GetWorkouts())
+		}
+	})
+	b.Run("list page", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			page, err := store.ListWorkouts(WorkoutFilter{UserID: userID, Limit: MaxWorkoutPageSize})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(page.Workouts) != MaxWorkoutPageSize {
+				b.Fatalf("got %d workouts, want %d", len(page.Workouts), MaxWorkoutPageSize)
+			}
+		}
+	})
+}
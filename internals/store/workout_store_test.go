@@ -3,12 +3,13 @@ package store
 import (
 	"database/sql"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
-func setupTestDB (t *testing.T) *sql.DB {
+func setupTestDB (t testing.TB) *sql.DB {
 	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=postgres_test port=5433")
 	if err != nil {
 		t.Fatalf("opening test db %v", err)
@@ -115,4 +116,152 @@ func IntPtr(i int) *int {
 
 func Float64Ptr(f float64) *float64 {
 	return &f
-}
\ No newline at end of file
+}
+func createTestUser(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`INSERT INTO users (name, email, password) VALUES ($1, $1 || '@example.com', 'not-a-hash') RETURNING id`, name).Scan(&id)
+	require.NoError(t, err)
+	return id
+}
+
+func TestListWorkouts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresWorkoutStore(db)
+	owner := createTestUser(t, db, "list-owner")
+	other := createTestUser(t, db, "list-other")
+
+	for i, title := range []string{"Push Day", "Pull Day", "Leg Day", "Easy Run", "Push Day B"} {
+		_, err := store.CreateWorkout(&Workout{
+			Title:           title,
+			DurationMinutes: 30 + i*10,
+			CaloriesBurned:  200 + i*50,
+			UserId:          owner,
+			Entries: []WorkoutEntry{
+				{ExerciseName: "Bench Press", Sets: 3, Reps: IntPtr(5), OrderIndex: 1},
+			},
+		})
+		require.NoError(t, err)
+	}
+	_, err = store.CreateWorkout(&Workout{Title: "Push Day", DurationMinutes: 45, UserId: other})
+	require.NoError(t, err)
+
+	t.Run("pages through the owner's workouts", func(t *testing.T) {
+		var seen []int
+		cursor := ""
+		for {
+			page, err := store.ListWorkouts(WorkoutFilter{UserID: owner, Sort: "duration_minutes", Limit: 2, Cursor: cursor})
+			require.NoError(t, err)
+			assert.Equal(t, 5, page.TotalCount)
+			for _, workout := range page.Workouts {
+				assert.Equal(t, owner, workout.UserId)
+				seen = append(seen, workout.DurationMinutes)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		assert.Equal(t, []int{30, 40, 50, 60, 70}, seen)
+	})
+
+	t.Run("filters by title and duration", func(t *testing.T) {
+		page, err := store.ListWorkouts(WorkoutFilter{UserID: owner, Search: "push", MinDuration: IntPtr(40)})
+		require.NoError(t, err)
+		require.Len(t, page.Workouts, 1)
+		assert.Equal(t, "Push Day B", page.Workouts[0].Title)
+		assert.Len(t, page.Workouts[0].Entries, 1)
+	})
+
+	t.Run("rejects unknown sort fields and foreign cursors", func(t *testing.T) {
+		_, err := store.ListWorkouts(WorkoutFilter{UserID: owner, Sort: "password"})
+		assert.ErrorIs(t, err, ErrInvalidSort)
+
+		page, err := store.ListWorkouts(WorkoutFilter{UserID: owner, Sort: "title", Limit: 1})
+		require.NoError(t, err)
+		_, err = store.ListWorkouts(WorkoutFilter{UserID: owner, Sort: "-created_at", Cursor: page.NextCursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestWorkoutPerformedAtTimezone(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users CASCADE")
+	require.NoError(t, err)
+
+	store := NewPostgresWorkoutStore(db)
+	owner := createTestUser(t, db, "tz-owner")
+
+	newYork, err := LoadTimezone("America/New_York")
+	require.NoError(t, err)
+	started := time.Date(2025, 1, 1, 22, 45, 0, 0, newYork)
+	ended := started.Add(75 * time.Minute) // 2025-01-02 05:00 UTC
+	created, err := store.CreateWorkout(&Workout{
+		Title:     "Late session",
+		UserId:    owner,
+		StartedAt: &started,
+		EndedAt:   &ended,
+		Timezone:  "America/New_York",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 75, created.DurationMinutes)
+	assert.True(t, created.PerformedAt.Equal(started))
+
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	page, err := store.ListWorkouts(WorkoutFilter{UserID: owner, From: &day, To: &day})
+	require.NoError(t, err)
+	require.Len(t, page.Workouts, 1)
+	assert.Equal(t, "America/New_York", page.Workouts[0].Timezone)
+
+	_, err = store.CreateWorkout(&Workout{Title: "Nowhere", UserId: owner, Timezone: "Mars/Olympus"})
+	assert.ErrorIs(t, err, ErrInvalidWorkout)
+}
+
+func TestPrepareEntrySets(t *testing.T) {
+	t.Run("derives legacy fields from the top working set", func(t *testing.T) {
+		entry := &WorkoutEntry{
+			ExerciseName: "Bench Press",
+			SetDetails: []WorkoutSet{
+				{SetType: SetTypeWarmup, Reps: IntPtr(10), WeightKg: Float64Ptr(60)},
+				{Reps: IntPtr(5), WeightKg: Float64Ptr(100)},
+				{Reps: IntPtr(5), WeightKg: Float64Ptr(105)},
+				{SetType: SetTypeFailure, Reps: IntPtr(3), WeightKg: Float64Ptr(110)},
+			},
+		}
+		require.NoError(t, prepareEntrySets(entry))
+		assert.Equal(t, 3, entry.Sets)
+		assert.Equal(t, IntPtr(3), entry.Reps)
+		assert.Equal(t, Float64Ptr(110), entry.WeightKg)
+		assert.Equal(t, SetTypeWorking, entry.SetDetails[1].SetType)
+	})
+
+	t.Run("expands legacy fields into working sets", func(t *testing.T) {
+		entry := &WorkoutEntry{ExerciseName: "Plank", Sets: 3, DurationSeconds: IntPtr(60)}
+		require.NoError(t, prepareEntrySets(entry))
+		require.Len(t, entry.SetDetails, 3)
+		for _, set := range entry.SetDetails {
+			assert.Equal(t, SetTypeWorking, set.SetType)
+			assert.Equal(t, IntPtr(60), set.DurationSeconds)
+			assert.Nil(t, set.Reps)
+		}
+	})
+
+	t.Run("rejects invalid sets", func(t *testing.T) {
+		entry := &WorkoutEntry{
+			ExerciseName: "Squat",
+			SetDetails:   []WorkoutSet{{SetType: "cluster", Reps: IntPtr(5)}},
+		}
+		assert.ErrorIs(t, prepareEntrySets(entry), ErrInvalidWorkout)
+
+		entry = &WorkoutEntry{
+			ExerciseName: "Squat",
+			SetDetails:   []WorkoutSet{{Reps: IntPtr(5), RPE: Float64Ptr(11)}},
+		}
+		assert.ErrorIs(t, prepareEntrySets(entry), ErrInvalidWorkout)
+	})
+}
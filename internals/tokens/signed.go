@@ -0,0 +1,229 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minSigningKeyLength is the shortest HMAC-SHA256 key we accept (256 bits).
+const minSigningKeyLength = 32
+
+var ErrInvalidSignedToken = errors.New("invalid or expired signed token")
+
+// Claims are the contents of a signed access token. The token is a JWT
+// signed with HS256, so it can be inspected with the usual tools.
+type Claims struct {
+	UserID      int      `json:"uid"`
+	SessionID   int      `json:"sid"` // token family, see store.Session
+	Scope       string   `json:"scope"`
+	Role        string   `json:"role"`
+	Activated   bool     `json:"act"`
+	Permissions []string `json:"perms,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	Expiry      int64    `json:"exp"`
+}
+
+type signedHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// Signer signs access tokens with the current key and verifies them with any
+// configured key. Keys are identified by a key ID in the token header, so a
+// new key can be introduced while tokens signed with the old one are still
+// in use.
+type Signer struct {
+	keys    map[string][]byte
+	current string
+}
+
+// NewSigner signs with the key current, which has to be one of keys.
+func NewSigner(keys map[string][]byte, current string) (*Signer, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", current)
+	}
+	for kid, key := range keys {
+		if kid == "" || strings.ContainsAny(kid, ":,") {
+			return nil, fmt.Errorf("invalid key ID %q", kid)
+		}
+		if len(key) < minSigningKeyLength {
+			return nil, fmt.Errorf("signing key %q must be at least %d bytes", kid, minSigningKeyLength)
+		}
+	}
+	return &Signer{keys: keys, current: current}, nil
+}
+
+// ParseSigningKeys reads keys written as "kid:base64key,kid:base64key". The
+// first key signs new tokens, the others only verify.
+func ParseSigningKeys(spec string) (*Signer, error) {
+	keys := map[string][]byte{}
+	current := ""
+	for _, entry := range strings.Split(spec, ",") {
+		kid, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("signing key %q is not in the form kid:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q is not valid base64: %w", kid, err)
+		}
+		if _, dup := keys[kid]; dup {
+			return nil, fmt.Errorf("duplicate key ID %q", kid)
+		}
+		keys[kid] = key
+		if current == "" {
+			current = kid
+		}
+	}
+	return NewSigner(keys, current)
+}
+
+// Sign returns a token for claims, which is issued now and valid for ttl.
+func (s *Signer) Sign(claims Claims, ttl time.Duration) (*Token, error) {
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.Expiry = now.Add(ttl).Unix()
+
+	header, err := json.Marshal(signedHeader{Alg: "HS256", Typ: "JWT", Kid: s.current})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	signature := sign(s.keys[s.current], signingInput)
+	return &Token{
+		FamilyID:  claims.SessionID,
+		PlainText: signingInput + "." + b64.EncodeToString(signature),
+		UserID:    claims.UserID,
+		Expiry:    time.Unix(claims.Expiry, 0),
+		Scope:     claims.Scope,
+	}, nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidSignedToken
+	}
+	var header signedHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidSignedToken
+	}
+	key, ok := s.keys[header.Kid]
+	if !ok {
+		return nil, ErrInvalidSignedToken
+	}
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(key, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidSignedToken
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+	if now.Unix() >= claims.Expiry {
+		return nil, ErrInvalidSignedToken
+	}
+	return &claims, nil
+}
+
+// IsSigned tells signed tokens from the random tokens kept in the database.
+func IsSigned(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func sign(key []byte, input string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := b64.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Revocation invalidates signed tokens before they expire: either one
+// session, or all sessions of a user up to BeforeSession. Session IDs only
+// grow, so sessions started after the revocation are not affected.
+type Revocation struct {
+	SessionID     int
+	UserID        int
+	BeforeSession int
+	Expiry        time.Time // when all tokens it applies to have expired
+}
+
+// RevocationList is the in-memory set of revocations checked for every
+// request, so that logging out works without a database lookup.
+type RevocationList struct {
+	mu       sync.RWMutex
+	sessions map[int]time.Time
+	users    map[int]Revocation
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{sessions: map[int]time.Time{}, users: map[int]Revocation{}}
+}
+
+func (l *RevocationList) Add(r Revocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.add(r)
+}
+
+func (l *RevocationList) add(r Revocation) {
+	if r.SessionID != 0 {
+		l.sessions[r.SessionID] = r.Expiry
+		return
+	}
+	if existing, ok := l.users[r.UserID]; !ok || r.BeforeSession > existing.BeforeSession {
+		l.users[r.UserID] = r
+	}
+}
+
+// Merge adds revocations loaded from elsewhere, e.g. made by other
+// instances, and drops the ones that have expired.
+func (l *RevocationList) Merge(rs []Revocation, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range rs {
+		l.add(r)
+	}
+	for id, expiry := range l.sessions {
+		if !expiry.After(now) {
+			delete(l.sessions, id)
+		}
+	}
+	for id, r := range l.users {
+		if !r.Expiry.After(now) {
+			delete(l.users, id)
+		}
+	}
+}
+
+func (l *RevocationList) Revoked(c *Claims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if _, ok := l.sessions[c.SessionID]; ok {
+		return true
+	}
+	r, ok := l.users[c.UserID]
+	return ok && c.SessionID < r.BeforeSession
+}
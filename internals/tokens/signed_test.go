@@ -0,0 +1,103 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, minSigningKeyLength)
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	signer, err := NewSigner(map[string][]byte{"k1": testKey(1)}, "k1")
+	require.NoError(t, err)
+
+	token, err := signer.Sign(Claims{UserID: 7, SessionID: 42, Scope: ScopeAuth, Role: "coach", Activated: true,
+		Permissions: []string{"workouts:read:any"}}, AccessTokenTTL)
+	require.NoError(t, err)
+	assert.True(t, IsSigned(token.PlainText))
+	assert.Equal(t, 42, token.FamilyID)
+
+	claims, err := signer.Verify(token.PlainText, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.UserID)
+	assert.Equal(t, 42, claims.SessionID)
+	assert.Equal(t, "coach", claims.Role)
+	assert.True(t, claims.Activated)
+	assert.Equal(t, []string{"workouts:read:any"}, claims.Permissions)
+
+	_, err = signer.Verify(token.PlainText, time.Now().Add(AccessTokenTTL))
+	assert.ErrorIs(t, err, ErrInvalidSignedToken, "expired")
+
+	parts := strings.Split(token.PlainText, ".")
+	forged, err := signer.Sign(Claims{UserID: 1, SessionID: 42, Scope: ScopeAuth}, AccessTokenTTL)
+	require.NoError(t, err)
+	tampered := parts[0] + "." + strings.Split(forged.PlainText, ".")[1] + "." + parts[2]
+	_, err = signer.Verify(tampered, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSignedToken, "claims swapped")
+
+	assert.False(t, IsSigned("ABCDEFGHIJKLMNOP"))
+}
+
+func TestSignerRotation(t *testing.T) {
+	old, err := NewSigner(map[string][]byte{"old": testKey(1)}, "old")
+	require.NoError(t, err)
+	token, err := old.Sign(Claims{UserID: 1, Scope: ScopeAuth}, AccessTokenTTL)
+	require.NoError(t, err)
+
+	spec := "new:" + base64.StdEncoding.EncodeToString(testKey(2)) + ",old:" + base64.StdEncoding.EncodeToString(testKey(1))
+	rotated, err := ParseSigningKeys(spec)
+	require.NoError(t, err)
+	_, err = rotated.Verify(token.PlainText, time.Now())
+	assert.NoError(t, err, "tokens of the previous key stay valid")
+
+	newToken, err := rotated.Sign(Claims{UserID: 1, Scope: ScopeAuth}, AccessTokenTTL)
+	require.NoError(t, err)
+	_, err = old.Verify(newToken.PlainText, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSignedToken, "signed with the new key")
+
+	retired, err := NewSigner(map[string][]byte{"new": testKey(2)}, "new")
+	require.NoError(t, err)
+	_, err = retired.Verify(token.PlainText, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSignedToken, "key removed")
+}
+
+func TestParseSigningKeysErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"k1",
+		"k1:not base64!",
+		"k1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"k1:" + base64.StdEncoding.EncodeToString(testKey(1)) + ",k1:" + base64.StdEncoding.EncodeToString(testKey(2)),
+	} {
+		_, err := ParseSigningKeys(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	now := time.Now()
+	list := NewRevocationList()
+	list.Add(Revocation{SessionID: 5, Expiry: now.Add(time.Minute)})
+	list.Add(Revocation{UserID: 2, BeforeSession: 10, Expiry: now.Add(time.Minute)})
+
+	assert.True(t, list.Revoked(&Claims{UserID: 1, SessionID: 5}))
+	assert.False(t, list.Revoked(&Claims{UserID: 1, SessionID: 6}))
+	assert.True(t, list.Revoked(&Claims{UserID: 2, SessionID: 9}))
+	assert.False(t, list.Revoked(&Claims{UserID: 2, SessionID: 10}), "session started after the revocation")
+
+	// An older revocation of the user does not undo a newer one.
+	list.Merge([]Revocation{{UserID: 2, BeforeSession: 3, Expiry: now.Add(time.Minute)}}, now)
+	assert.True(t, list.Revoked(&Claims{UserID: 2, SessionID: 9}))
+
+	list.Merge(nil, now.Add(2*time.Minute))
+	assert.False(t, list.Revoked(&Claims{UserID: 1, SessionID: 5}), "expired revocations are dropped")
+	assert.False(t, list.Revoked(&Claims{UserID: 2, SessionID: 9}))
+}
@@ -8,15 +8,32 @@ import (
 )
 
 type Token struct {
+	ID        int    `json:"-"`
+	FamilyID  int    `json:"-"` // the login session the token belongs to
 	PlainText string `json:"plaintext"`
 	Hash	  []byte `json:"-"`
 	UserID   int    `json:"-"`
 	Expiry   time.Time `json:"expiry"`
 	Scope    string `json:"-"`
+	// client the token was issued to, shown in the session list
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 const (
 	ScopeAuth = "Authentication"
+	ScopeRefresh = "Refresh"
+	ScopePasswordReset = "PasswordReset"
+	ScopeActivation = "Activation"
+	ScopeMFAChallenge = "MFAChallenge"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	PasswordResetTokenTTL = 30 * time.Minute
+	ActivationTokenTTL = 3 * 24 * time.Hour
+	MFAChallengeTTL = 5 * time.Minute
 )
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
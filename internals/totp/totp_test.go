@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SHA1 test vectors from RFC 6238, appendix B.
+func TestRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		at := time.Unix(v.unix, 0)
+		assert.Equal(t, v.code, hotp(secret, Step(at), 8), "at %d", v.unix)
+		assert.Equal(t, v.code[2:], Code(secret, at), "at %d", v.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	at := time.Unix(1111111111, 0)
+
+	step, ok := Validate(secret, "050471", at)
+	assert.True(t, ok)
+	assert.Equal(t, Step(at), step)
+
+	// The previous code is still accepted, two periods ago is not.
+	step, ok = Validate(secret, Code(secret, at.Add(-Period)), at)
+	assert.True(t, ok)
+	assert.Equal(t, Step(at)-1, step)
+	_, ok = Validate(secret, Code(secret, at.Add(-2*Period)), at)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "000000", at)
+	assert.False(t, ok)
+	_, ok = Validate(secret, "50471", at)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 20)
+
+	uri := ProvisioningURI("Workouts", "jane@example.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Workouts:jane@example.com?"), uri)
+	assert.Contains(t, uri, "secret="+EncodeSecret(secret))
+	assert.Contains(t, uri, "issuer=Workouts")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}
@@ -7,6 +7,7 @@ import (
 	"go_beginner/internals/routes"
 	"net/http"
 	"time"
+	_ "time/tzdata" // workouts carry IANA timezones, don't depend on the host's zoneinfo
 )
 func main() {
 	var port int
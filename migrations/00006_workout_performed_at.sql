@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+    ADD COLUMN performed_at TIMESTAMPTZ,
+    ADD COLUMN started_at TIMESTAMPTZ,
+    ADD COLUMN ended_at TIMESTAMPTZ,
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+UPDATE workouts SET performed_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+
+ALTER TABLE workouts
+    ALTER COLUMN performed_at SET NOT NULL,
+    ALTER COLUMN performed_at SET DEFAULT CURRENT_TIMESTAMP,
+    ADD CONSTRAINT valid_workout_times CHECK (
+        started_at IS NULL OR ended_at IS NULL OR ended_at >= started_at
+    );
+
+CREATE INDEX IF NOT EXISTS idx_workouts_user_performed_at ON workouts (user_id, performed_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_performed_at;
+ALTER TABLE workouts
+    DROP CONSTRAINT IF EXISTS valid_workout_times,
+    DROP COLUMN IF EXISTS performed_at,
+    DROP COLUMN IF EXISTS started_at,
+    DROP COLUMN IF EXISTS ended_at,
+    DROP COLUMN IF EXISTS timezone;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_entry_sets (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+    set_index INTEGER NOT NULL,
+    set_type VARCHAR(20) NOT NULL DEFAULT 'working',
+    reps INTEGER,
+    duration_seconds INTEGER,
+    weight DECIMAL(5, 2),
+    rpe DECIMAL(3, 1),
+    rir INTEGER,
+    rest_seconds INTEGER,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_set_type CHECK (set_type IN ('warmup', 'working', 'drop', 'failure')),
+    CONSTRAINT valid_workout_set CHECK (
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL)
+        AND
+        (reps IS NULL OR duration_seconds IS NULL)
+    ),
+    CONSTRAINT valid_set_rpe CHECK (rpe IS NULL OR rpe BETWEEN 1 AND 10),
+    CONSTRAINT valid_set_rir CHECK (rir IS NULL OR rir >= 0),
+    CONSTRAINT valid_set_rest CHECK (rest_seconds IS NULL OR rest_seconds >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_entry_sets_entry ON workout_entry_sets (entry_id, set_index);
+
+-- Existing entries only know "N sets of the same reps and weight".
+INSERT INTO workout_entry_sets (entry_id, set_index, set_type, reps, duration_seconds, weight)
+SELECT e.id, n, 'working', e.reps, e.duration_seconds, e.weight
+FROM workout_entries e
+CROSS JOIN LATERAL generate_series(1, GREATEST(e.sets, 1)) AS n;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_entry_sets;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exercises (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    primary_muscles TEXT[] NOT NULL DEFAULT '{}',
+    secondary_muscles TEXT[] NOT NULL DEFAULT '{}',
+    equipment VARCHAR(50) NOT NULL DEFAULT '',
+    movement_pattern VARCHAR(50) NOT NULL DEFAULT '',
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE, -- NULL for the built-in library
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_builtin_name ON exercises (LOWER(name)) WHERE user_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_custom_name ON exercises (user_id, LOWER(name)) WHERE user_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS exercise_aliases (
+    id BIGSERIAL PRIMARY KEY,
+    exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    alias VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercise_aliases_exercise_alias ON exercise_aliases (exercise_id, LOWER(alias));
+CREATE INDEX IF NOT EXISTS idx_exercise_aliases_alias ON exercise_aliases (LOWER(alias));
+
+ALTER TABLE workout_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise ON workout_entries (exercise_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP COLUMN IF EXISTS exercise_id;
+DROP TABLE IF EXISTS exercise_aliases;
+DROP TABLE IF EXISTS exercises;
+-- +goose StatementEnd
@@ -0,0 +1,144 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO exercises (name, primary_muscles, secondary_muscles, equipment, movement_pattern) VALUES
+    ('Barbell Bench Press',        '{chest}',              '{triceps,front_delts}',          'barbell',    'horizontal_push'),
+    ('Incline Barbell Bench Press','{chest}',              '{front_delts,triceps}',          'barbell',    'horizontal_push'),
+    ('Dumbbell Bench Press',       '{chest}',              '{triceps,front_delts}',          'dumbbell',   'horizontal_push'),
+    ('Incline Dumbbell Press',     '{chest}',              '{front_delts,triceps}',          'dumbbell',   'horizontal_push'),
+    ('Push-Up',                    '{chest}',              '{triceps,front_delts,abs}',      'bodyweight', 'horizontal_push'),
+    ('Dip',                        '{chest,triceps}',      '{front_delts}',                  'bodyweight', 'vertical_push'),
+    ('Cable Fly',                  '{chest}',              '{front_delts}',                  'cable',      'isolation'),
+    ('Overhead Press',             '{shoulders}',          '{triceps,upper_back}',           'barbell',    'vertical_push'),
+    ('Dumbbell Shoulder Press',    '{shoulders}',          '{triceps}',                      'dumbbell',   'vertical_push'),
+    ('Lateral Raise',              '{shoulders}',          '{}',                             'dumbbell',   'isolation'),
+    ('Face Pull',                  '{rear_delts}',         '{upper_back}',                   'cable',      'horizontal_pull'),
+    ('Pull-Up',                    '{lats}',               '{biceps,upper_back}',            'bodyweight', 'vertical_pull'),
+    ('Chin-Up',                    '{lats,biceps}',        '{upper_back}',                   'bodyweight', 'vertical_pull'),
+    ('Lat Pulldown',               '{lats}',               '{biceps,upper_back}',            'cable',      'vertical_pull'),
+    ('Barbell Row',                '{upper_back,lats}',    '{biceps,rear_delts,lower_back}', 'barbell',    'horizontal_pull'),
+    ('Dumbbell Row',               '{lats,upper_back}',    '{biceps,rear_delts}',            'dumbbell',   'horizontal_pull'),
+    ('Seated Cable Row',           '{upper_back,lats}',    '{biceps,rear_delts}',            'cable',      'horizontal_pull'),
+    ('Barbell Curl',               '{biceps}',             '{forearms}',                     'barbell',    'isolation'),
+    ('Dumbbell Curl',              '{biceps}',             '{forearms}',                     'dumbbell',   'isolation'),
+    ('Triceps Pushdown',           '{triceps}',            '{}',                             'cable',      'isolation'),
+    ('Skull Crusher',              '{triceps}',            '{}',                             'barbell',    'isolation'),
+    ('Back Squat',                 '{quads,glutes}',       '{hamstrings,lower_back,abs}',    'barbell',    'squat'),
+    ('Front Squat',                '{quads}',              '{glutes,upper_back,abs}',        'barbell',    'squat'),
+    ('Goblet Squat',               '{quads,glutes}',       '{abs}',                          'dumbbell',   'squat'),
+    ('Leg Press',                  '{quads,glutes}',       '{hamstrings}',                   'machine',    'squat'),
+    ('Deadlift',                   '{hamstrings,glutes,lower_back}', '{upper_back,forearms,quads}', 'barbell', 'hinge'),
+    ('Romanian Deadlift',          '{hamstrings,glutes}',  '{lower_back}',                   'barbell',    'hinge'),
+    ('Hip Thrust',                 '{glutes}',             '{hamstrings}',                   'barbell',    'hinge'),
+    ('Kettlebell Swing',           '{glutes,hamstrings}',  '{lower_back,shoulders}',         'kettlebell', 'hinge'),
+    ('Walking Lunge',              '{quads,glutes}',       '{hamstrings}',                   'dumbbell',   'lunge'),
+    ('Bulgarian Split Squat',      '{quads,glutes}',       '{hamstrings}',                   'dumbbell',   'lunge'),
+    ('Leg Curl',                   '{hamstrings}',         '{calves}',                       'machine',    'isolation'),
+    ('Leg Extension',              '{quads}',              '{}',                             'machine',    'isolation'),
+    ('Standing Calf Raise',        '{calves}',             '{}',                             'machine',    'isolation'),
+    ('Farmer''s Carry',            '{forearms,upper_back}','{abs,glutes}',                   'dumbbell',   'carry'),
+    ('Plank',                      '{abs}',                '{shoulders,glutes}',             'bodyweight', 'core'),
+    ('Hanging Leg Raise',          '{abs}',                '{forearms}',                     'bodyweight', 'core'),
+    ('Running',                    '{cardio}',             '{quads,hamstrings,calves}',      'none',       'cardio'),
+    ('Cycling',                    '{cardio}',             '{quads,glutes}',                 'machine',    'cardio'),
+    ('Rowing',                     '{cardio}',             '{upper_back,lats,quads}',        'machine',    'cardio'),
+    ('Walking',                    '{cardio}',             '{calves}',                       'none',       'cardio'),
+    ('Jump Rope',                  '{cardio}',             '{calves,shoulders}',             'none',       'cardio');
+
+INSERT INTO exercise_aliases (exercise_id, alias)
+SELECT e.id, a.alias
+FROM (VALUES
+    ('Barbell Bench Press', 'Bench'),
+    ('Barbell Bench Press', 'Bench Press'),
+    ('Barbell Bench Press', 'BB Bench Press'),
+    ('Barbell Bench Press', 'Flat Bench'),
+    ('Incline Barbell Bench Press', 'Incline Bench'),
+    ('Incline Barbell Bench Press', 'Incline Bench Press'),
+    ('Dumbbell Bench Press', 'DB Bench Press'),
+    ('Dumbbell Bench Press', 'DB Bench'),
+    ('Incline Dumbbell Press', 'Incline DB Press'),
+    ('Push-Up', 'Push Up'),
+    ('Push-Up', 'Pushup'),
+    ('Push-Up', 'Press Up'),
+    ('Dip', 'Dips'),
+    ('Dip', 'Parallel Bar Dip'),
+    ('Cable Fly', 'Cable Crossover'),
+    ('Cable Fly', 'Chest Fly'),
+    ('Overhead Press', 'OHP'),
+    ('Overhead Press', 'Military Press'),
+    ('Overhead Press', 'Shoulder Press'),
+    ('Overhead Press', 'Standing Press'),
+    ('Dumbbell Shoulder Press', 'DB Shoulder Press'),
+    ('Lateral Raise', 'Side Raise'),
+    ('Lateral Raise', 'Lateral Raises'),
+    ('Pull-Up', 'Pull Up'),
+    ('Pull-Up', 'Pullup'),
+    ('Pull-Up', 'Pull-Ups'),
+    ('Chin-Up', 'Chin Up'),
+    ('Chin-Up', 'Chinup'),
+    ('Lat Pulldown', 'Pulldown'),
+    ('Lat Pulldown', 'Lat Pull Down'),
+    ('Barbell Row', 'Bent Over Row'),
+    ('Barbell Row', 'BB Row'),
+    ('Barbell Row', 'Pendlay Row'),
+    ('Dumbbell Row', 'DB Row'),
+    ('Dumbbell Row', 'One Arm Row'),
+    ('Seated Cable Row', 'Cable Row'),
+    ('Barbell Curl', 'Curl'),
+    ('Barbell Curl', 'BB Curl'),
+    ('Dumbbell Curl', 'DB Curl'),
+    ('Dumbbell Curl', 'Bicep Curl'),
+    ('Triceps Pushdown', 'Tricep Pushdown'),
+    ('Triceps Pushdown', 'Rope Pushdown'),
+    ('Skull Crusher', 'Lying Triceps Extension'),
+    ('Back Squat', 'Squat'),
+    ('Back Squat', 'Squats'),
+    ('Back Squat', 'BB Squat'),
+    ('Back Squat', 'Barbell Squat'),
+    ('Deadlift', 'Conventional Deadlift'),
+    ('Deadlift', 'DL'),
+    ('Romanian Deadlift', 'RDL'),
+    ('Hip Thrust', 'Barbell Hip Thrust'),
+    ('Kettlebell Swing', 'KB Swing'),
+    ('Walking Lunge', 'Lunge'),
+    ('Walking Lunge', 'Lunges'),
+    ('Bulgarian Split Squat', 'BSS'),
+    ('Bulgarian Split Squat', 'Split Squat'),
+    ('Leg Curl', 'Hamstring Curl'),
+    ('Standing Calf Raise', 'Calf Raise'),
+    ('Farmer''s Carry', 'Farmers Walk'),
+    ('Farmer''s Carry', 'Farmer Carry'),
+    ('Hanging Leg Raise', 'Leg Raise'),
+    ('Running', 'Run'),
+    ('Running', 'Jog'),
+    ('Running', 'Jogging'),
+    ('Running', 'Treadmill'),
+    ('Cycling', 'Bike'),
+    ('Cycling', 'Spin'),
+    ('Rowing', 'Row Erg'),
+    ('Rowing', 'Erg'),
+    ('Walking', 'Walk'),
+    ('Jump Rope', 'Skipping')
+) AS a(name, alias)
+JOIN exercises e ON e.name = a.name AND e.user_id IS NULL;
+
+-- Link the entries logged so far to the catalog.
+UPDATE workout_entries we
+SET exercise_id = e.id
+FROM exercises e
+WHERE we.exercise_id IS NULL
+  AND e.user_id IS NULL
+  AND (
+      LOWER(e.name) = LOWER(TRIM(we.exercise_name))
+      OR EXISTS (
+          SELECT 1 FROM exercise_aliases a
+          WHERE a.exercise_id = e.id AND LOWER(a.alias) = LOWER(TRIM(we.exercise_name))
+      )
+  );
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE workout_entries SET exercise_id = NULL
+WHERE exercise_id IN (SELECT id FROM exercises WHERE user_id IS NULL);
+DELETE FROM exercises WHERE user_id IS NULL;
+-- +goose StatementEnd
@@ -0,0 +1,66 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS programs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- author, usually a coach
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    weeks INTEGER NOT NULL CHECK (weeks BETWEEN 1 AND 52),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS program_days (
+    id BIGSERIAL PRIMARY KEY,
+    program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    week INTEGER NOT NULL CHECK (week >= 1),
+    day INTEGER NOT NULL CHECK (day BETWEEN 1 AND 7),
+    template_id BIGINT NOT NULL REFERENCES workout_templates(id) ON DELETE RESTRICT,
+    title VARCHAR(100) NOT NULL DEFAULT '',
+    UNIQUE (program_id, week, day)
+);
+
+-- e.g. "+2.5kg per week on the main lifts"
+CREATE TABLE IF NOT EXISTS program_progressions (
+    id BIGSERIAL PRIMARY KEY,
+    program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    increment_kg DECIMAL(5, 2) NOT NULL,
+    every_weeks INTEGER NOT NULL DEFAULT 1 CHECK (every_weeks >= 1)
+);
+
+CREATE TABLE IF NOT EXISTS program_enrollments (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_program_enrollments_active ON program_enrollments (user_id) WHERE status = 'active';
+
+ALTER TABLE workouts
+ADD COLUMN program_day_id BIGINT REFERENCES program_days(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS program_day_completions (
+    enrollment_id BIGINT NOT NULL REFERENCES program_enrollments(id) ON DELETE CASCADE,
+    program_day_id BIGINT NOT NULL REFERENCES program_days(id) ON DELETE CASCADE,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    completed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (enrollment_id, program_day_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS program_day_completions;
+ALTER TABLE workouts
+DROP COLUMN IF EXISTS program_day_id;
+DROP TABLE IF EXISTS program_enrollments;
+DROP TABLE IF EXISTS program_progressions;
+DROP TABLE IF EXISTS program_days;
+DROP TABLE IF EXISTS programs;
+-- +goose StatementEnd
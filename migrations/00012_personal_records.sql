@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS personal_records (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    record_type VARCHAR(30) NOT NULL,
+    value DECIMAL(10, 2) NOT NULL,
+    weight DECIMAL(5, 2), -- the set behind the record, if any
+    reps INTEGER,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    achieved_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_record_type CHECK (record_type IN
+        ('max_weight', 'max_reps_at_weight', 'e1rm_epley', 'e1rm_brzycki', 'longest_duration', 'max_volume'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_records_user ON personal_records (user_id, exercise_id, record_type);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS personal_records;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entry_sets
+ADD COLUMN distance_meters DECIMAL(10, 2) CHECK (distance_meters IS NULL OR distance_meters >= 0);
+
+CREATE TABLE IF NOT EXISTS goals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(100) NOT NULL,
+    metric VARCHAR(30) NOT NULL CHECK (metric IN ('workouts', 'calories', 'duration_minutes', 'distance', 'lift')),
+    target DECIMAL(12, 2) NOT NULL CHECK (target > 0),
+    period VARCHAR(10) CHECK (period IN ('week', 'month')), -- NULL for a one-off goal
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    deadline DATE,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_goal_deadline CHECK (deadline IS NULL OR deadline >= start_date),
+    CONSTRAINT valid_lift_goal CHECK (metric <> 'lift' OR exercise_id IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_goals_user ON goals (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS goals;
+ALTER TABLE workout_entry_sets
+DROP COLUMN IF EXISTS distance_meters;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens
+ADD COLUMN id BIGSERIAL UNIQUE,
+ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN last_used_at TIMESTAMPTZ,
+ADD COLUMN ip VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_tokens_user ON tokens (user_id, scope);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tokens_user;
+ALTER TABLE tokens
+DROP COLUMN IF EXISTS id,
+DROP COLUMN IF EXISTS created_at,
+DROP COLUMN IF EXISTS last_used_at,
+DROP COLUMN IF EXISTS ip,
+DROP COLUMN IF EXISTS user_agent;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A family is one login: the access and refresh tokens issued by it and by
+-- every refresh since.
+ALTER TABLE tokens
+ADD COLUMN family_id BIGINT,
+ADD COLUMN used_at TIMESTAMPTZ; -- refresh tokens can be used once
+
+UPDATE tokens SET family_id = id;
+
+CREATE INDEX IF NOT EXISTS idx_tokens_family ON tokens (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM tokens WHERE scope = 'Refresh';
+DROP INDEX IF EXISTS idx_tokens_family;
+ALTER TABLE tokens
+DROP COLUMN IF EXISTS family_id,
+DROP COLUMN IF EXISTS used_at;
+-- +goose StatementEnd
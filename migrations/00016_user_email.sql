@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+
+-- Accounts without an email, or sharing one with an older account, get a
+-- placeholder they can change later.
+UPDATE users u
+SET email = 'user' || u.id || '@users.invalid'
+WHERE u.email IS NULL OR u.email = '' OR EXISTS (
+    SELECT 1 FROM users older
+    WHERE LOWER(older.email) = LOWER(u.email) AND older.id < u.id
+);
+
+ALTER TABLE users
+ALTER COLUMN email SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email));
+
+ALTER TABLE users
+ADD COLUMN activated BOOLEAN NOT NULL DEFAULT false;
+
+-- Existing accounts predate email verification.
+UPDATE users SET activated = true;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM tokens WHERE scope = 'Activation';
+ALTER TABLE users
+DROP COLUMN IF EXISTS activated;
+DROP INDEX IF EXISTS idx_users_email_lower;
+ALTER TABLE users
+ALTER COLUMN email DROP NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(30) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(60) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(30) NOT NULL REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    permission VARCHAR(60) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Manages their own training data'),
+    ('coach', 'Can also read the workouts of any user'),
+    ('admin', 'Can manage users and roles');
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'List and search users'),
+    ('roles:assign', 'Change the role of a user'),
+    ('workouts:read:any', 'Read the workouts of any user');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('coach', 'workouts:read:any'),
+    ('admin', 'users:read'),
+    ('admin', 'roles:assign'),
+    ('admin', 'workouts:read:any');
+
+ALTER TABLE users
+ADD COLUMN role VARCHAR(30) NOT NULL DEFAULT 'user' REFERENCES roles(name) ON UPDATE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN IF EXISTS role;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Failed logins per account ("email:<address>") and per client ("ip:<address>").
+-- Keys are not tied to users so that unknown emails are throttled the same way.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret BYTEA NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT false, -- false until confirmed with a first code
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- TOTP codes at or before this step are rejected
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    enabled_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash BYTEA NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM tokens WHERE scope = 'MFAChallenge';
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+-- +goose StatementEnd
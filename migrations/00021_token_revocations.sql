@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Revoked signed access tokens (TOKEN_MODE=signed). Either one session, or
+-- all sessions of a user started before before_session_id. Rows are only
+-- needed until the tokens they cover have expired.
+CREATE TABLE IF NOT EXISTS token_revocations (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT,
+    user_id BIGINT,
+    before_session_id BIGINT,
+    expiry TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_token_revocation CHECK (
+        (session_id IS NOT NULL AND user_id IS NULL AND before_session_id IS NULL)
+        OR (session_id IS NULL AND user_id IS NOT NULL AND before_session_id IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_revocations_expiry ON token_revocations (expiry);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS token_revocations;
+-- +goose StatementEnd
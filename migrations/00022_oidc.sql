@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Logins with an external OpenID Connect provider that are waiting for the
+-- callback. The state is stored hashed, like tokens.
+CREATE TABLE IF NOT EXISTS oidc_auth_requests (
+    state_hash BYTEA PRIMARY KEY,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Provider accounts linked to users, by the issuer and subject of their ID
+-- tokens.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS oidc_auth_requests;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The security audit log. It is append-only: rows cannot be updated or
+-- deleted, and there is no foreign key to users so that the events of a
+-- deleted account are kept.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    email TEXT NOT NULL DEFAULT '',
+    type VARCHAR(40) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_events_user_id ON auth_events (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON auth_events (created_at DESC);
+
+CREATE OR REPLACE FUNCTION auth_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_events_append_only
+BEFORE UPDATE OR DELETE ON auth_events
+FOR EACH ROW EXECUTE FUNCTION auth_events_append_only();
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'Read the security audit log of all users');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'audit:read');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'audit:read';
+DROP TABLE IF EXISTS auth_events;
+DROP FUNCTION IF EXISTS auth_events_append_only();
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Optional details and preferences of a user. Measurements are stored in
+-- metric units; the unit columns only say how clients should display them.
+CREATE TABLE IF NOT EXISTS user_profiles (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    weight_unit VARCHAR(2) NOT NULL DEFAULT 'kg' CHECK (weight_unit IN ('kg', 'lb')),
+    distance_unit VARCHAR(2) NOT NULL DEFAULT 'km' CHECK (distance_unit IN ('km', 'mi')),
+    date_of_birth DATE,
+    height_cm NUMERIC(5, 1),
+    sex VARCHAR(10) CHECK (sex IN ('female', 'male', 'other')),
+    body_weight_kg NUMERIC(5, 1),
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    week_start VARCHAR(9) NOT NULL DEFAULT 'monday',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_profiles;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a user cascades to both their programs and their templates, and a
+-- RESTRICT reference from program_days to the templates made that fail.
+-- DeleteTemplate checks for scheduled days itself.
+ALTER TABLE program_days
+DROP CONSTRAINT IF EXISTS program_days_template_id_fkey,
+ADD CONSTRAINT program_days_template_id_fkey FOREIGN KEY (template_id) REFERENCES workout_templates(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE program_days
+DROP CONSTRAINT IF EXISTS program_days_template_id_fkey,
+ADD CONSTRAINT program_days_template_id_fkey FOREIGN KEY (template_id) REFERENCES workout_templates(id) ON DELETE RESTRICT;
+-- +goose StatementEnd
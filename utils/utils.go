@@ -3,9 +3,12 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -48,4 +51,40 @@ func MatchRegex(pattern, str string) bool {
 		return false
 	}
 	return matched
-}
\ No newline at end of file
+}
+
+// ReadIntQuery returns nil when the query parameter is absent.
+func ReadIntQuery(qs url.Values, key string) (*int, error) {
+	value := qs.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter: must be an integer", key)
+	}
+	return &i, nil
+}
+
+// ReadDateQuery parses a YYYY-MM-DD query parameter, nil when absent.
+func ReadDateQuery(qs url.Values, key string) (*time.Time, error) {
+	value := qs.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter: must be a YYYY-MM-DD date", key)
+	}
+	return &date, nil
+}
+
+// ClientIP returns the address of the client that sent the request. Proxy
+// headers are not trusted since anyone can set them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}